@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/APTy/uuidcrypt"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRotateDecrypt = errors.New("cli: cannot rotate and decrypt at the same time")
+	ErrNoValues      = errors.New("cli: no uuids given")
+	ErrUnknownFormat = errors.New("cli: unknown format")
+	ErrColumnNumber  = errors.New("cli: columns must be field paths with -format json or jsonl")
+	ErrTextColumns   = errors.New("cli: columns are not supported with -format text")
+	ErrTextFlag      = errors.New("cli: flag is not supported with -format text")
+	ErrCSVOnlyFlag   = errors.New("cli: flag is only supported with -format csv")
+	ErrJSONOnlyFlag  = errors.New("cli: flag is only supported with -format json or jsonl")
+)
+
+// Exit codes returned by CLI.Run, one per class of failure.
+const (
+	ExitOK = iota
+	ExitError
+	ExitConfig
+	ExitIO
+	ExitParse
+	ExitCrypto
+)
+
+type CLI struct {
+	cfg RunConfig
+}
+
+func NewCLI(cfg RunConfig) CLI {
+	return CLI{cfg: cfg}
+}
+
+// Run runs the CLI and returns its exit code. Errors are printed to
+// stderr.
+func (c CLI) Run() int {
+	if err := c.run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitCode(err)
+	}
+	return ExitOK
+}
+
+func exitCode(err error) int {
+	switch uuidcrypt.KindOf(err) {
+	case uuidcrypt.ConfigError:
+		return ExitConfig
+	case uuidcrypt.IOError:
+		return ExitIO
+	case uuidcrypt.ParseError:
+		return ExitParse
+	case uuidcrypt.CryptoError:
+		return ExitCrypto
+	}
+	return ExitError
+}
+
+// withKind wraps err as a *uuidcrypt.Error of the given kind, unless
+// it already is one.
+func withKind(kind uuidcrypt.ErrorKind, err error) error {
+	if err == nil || uuidcrypt.KindOf(err) != 0 {
+		return err
+	}
+	return &uuidcrypt.Error{Kind: kind, Err: err}
+}
+
+func (c CLI) run() error {
+	if err := c.cfg.Load(); err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	cfg := c.cfg.Config()
+	if cfg.showVersion {
+		fmt.Fprintf(os.Stdout, "uuidcrypt %s\n", uuidcrypt.Version)
+		return withKind(uuidcrypt.IOError, c.cfg.Abort())
+	}
+	if cfg.command != "" {
+		return processValues(cfg, os.Stdout)
+	}
+	if err := c.process(cfg); err != nil {
+		c.cfg.Abort()
+		return err
+	}
+	if err := c.cfg.Done(); err != nil {
+		return withKind(uuidcrypt.IOError, err)
+	}
+	return nil
+}
+
+func (c CLI) process(cfg Config) error {
+	switch cfg.format {
+	case "", csvFormat:
+		return processCSV(cfg)
+	case jsonFormat, jsonlFormat:
+		return processJSON(cfg)
+	case textFormat:
+		return processText(cfg)
+	}
+	return withKind(uuidcrypt.ConfigError, fmt.Errorf("%w: %q", ErrUnknownFormat, cfg.format))
+}
+
+func processCSV(cfg Config) error {
+	if cfg.allUUIDs {
+		return withKind(uuidcrypt.ConfigError, fmt.Errorf("%w: -all-uuids", ErrJSONOnlyFlag))
+	}
+	processor, err := newProcessor(cfg)
+	if err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	options, err := columnOptions(cfg)
+	if err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	policy, err := uuidcrypt.ParseRowErrorPolicy(cfg.onError)
+	if err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	format, err := uuidcrypt.ParseUUIDFormat(cfg.uuidFormat)
+	if err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	options = append(options, uuidcrypt.WithRowErrorPolicy(policy), uuidcrypt.WithUUIDFormat(format), uuidcrypt.WithWorkers(cfg.workers))
+	compression, err := uuidcrypt.ParseCompression(cfg.compress)
+	if err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	if cfg.rejectFile != "" {
+		options = append(options, uuidcrypt.WithRejectFile(uuidcrypt.NewCSVFile(cfg.rejectFile, uuidcrypt.WithDelimiter(cfg.delimiterOutput))))
+	}
+	uuidCrypt := uuidcrypt.NewUUIDCrypt(
+		uuidcrypt.NewCSVFile(cfg.inputFile, uuidcrypt.WithDelimiter(cfg.delimiter), uuidcrypt.WithMaxRecordSize(cfg.maxRecordSize)),
+		uuidcrypt.NewCSVFile(cfg.outputFile, uuidcrypt.WithDelimiter(cfg.delimiterOutput), uuidcrypt.WithCompression(compression)),
+		processor,
+		options...,
+	)
+	return uuidCrypt.Run()
+}
+
+// processJSON processes the string values at the field paths given as
+// columns in a JSON or JSON Lines file.
+func processJSON(cfg Config) error {
+	if err := checkCSVOnlyFlags(cfg); err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	processor, err := newProcessor(cfg)
+	if err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	options, err := jsonOptions(cfg)
+	if err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	return processStream(cfg, func(input io.Reader, output io.Writer) uuidcrypt.UUIDCrypt {
+		if cfg.format == jsonlFormat {
+			return uuidcrypt.NewJSONLinesCrypt(input, output, processor, options...)
+		}
+		return uuidcrypt.NewJSONCrypt(input, output, processor, options...)
+	})
+}
+
+// checkCSVOnlyFlags rejects the flags that only apply to CSV files,
+// rather than silently ignoring them.
+func checkCSVOnlyFlags(cfg Config) error {
+	switch {
+	case cfg.contextColumn != (columnSpec{}):
+		return fmt.Errorf("%w: -context", ErrCSVOnlyFlag)
+	case cfg.header:
+		return fmt.Errorf("%w: -header", ErrCSVOnlyFlag)
+	case cfg.workers > 1:
+		return fmt.Errorf("%w: -j", ErrCSVOnlyFlag)
+	case cfg.maxRecordSize != 0:
+		return fmt.Errorf("%w: -max-record-size", ErrCSVOnlyFlag)
+	case cfg.delimiter != "":
+		return fmt.Errorf("%w: -F", ErrCSVOnlyFlag)
+	case cfg.delimiterOutput != "":
+		return fmt.Errorf("%w: -OF", ErrCSVOnlyFlag)
+	case cfg.rejectFile != "":
+		return fmt.Errorf("%w: -reject-file", ErrCSVOnlyFlag)
+	}
+	return nil
+}
+
+// processText processes every UUID in a plain text file.
+func processText(cfg Config) error {
+	if len(cfg.columns) > 0 {
+		return withKind(uuidcrypt.ConfigError, ErrTextColumns)
+	}
+	if err := checkCSVOnlyFlags(cfg); err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	if cfg.allUUIDs {
+		return withKind(uuidcrypt.ConfigError, fmt.Errorf("%w: -all-uuids", ErrJSONOnlyFlag))
+	}
+	if cfg.onError != "" {
+		return withKind(uuidcrypt.ConfigError, fmt.Errorf("%w: -on-error", ErrTextFlag))
+	}
+	processor, err := newProcessor(cfg)
+	if err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	format, err := uuidcrypt.ParseUUIDFormat(cfg.uuidFormat)
+	if err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	return processStream(cfg, func(input io.Reader, output io.Writer) uuidcrypt.UUIDCrypt {
+		return uuidcrypt.NewTextCrypt(input, output, processor, uuidcrypt.WithTextUUIDFormat(format))
+	})
+}
+
+// processStream runs the UUIDCrypt returned by newUUIDCrypt on the
+// input and output files.
+func processStream(cfg Config, newUUIDCrypt func(io.Reader, io.Writer) uuidcrypt.UUIDCrypt) (err error) {
+	compression, err := uuidcrypt.ParseCompression(cfg.compress)
+	if err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	input, err := uuidcrypt.OpenFile(cfg.inputFile)
+	if err != nil {
+		return withKind(uuidcrypt.IOError, err)
+	}
+	defer input.Close()
+	output, err := uuidcrypt.CreateCompressedFile(cfg.outputFile, compression)
+	if err != nil {
+		return withKind(uuidcrypt.IOError, err)
+	}
+	defer func() {
+		if closeErr := output.Close(); err == nil {
+			err = withKind(uuidcrypt.IOError, closeErr)
+		}
+	}()
+	return newUUIDCrypt(input, output).Run()
+}
+
+// jsonOptions returns the JSON options selecting the field paths to
+// process, their namespaces, and the error policy.
+func jsonOptions(cfg Config) ([]uuidcrypt.JSONOptions, error) {
+	policy, err := uuidcrypt.ParseRowErrorPolicy(cfg.onError)
+	if err != nil {
+		return nil, err
+	}
+	format, err := uuidcrypt.ParseUUIDFormat(cfg.uuidFormat)
+	if err != nil {
+		return nil, err
+	}
+	options := []uuidcrypt.JSONOptions{uuidcrypt.WithJSONErrorPolicy(policy), uuidcrypt.WithJSONUUIDFormat(format)}
+	if cfg.allUUIDs {
+		options = append(options, uuidcrypt.WithAllUUIDStrings())
+	}
+	for _, spec := range cfg.columns {
+		if spec.name == "" {
+			return nil, fmt.Errorf("%w: %d", ErrColumnNumber, spec.index)
+		}
+		if spec.namespace == "" {
+			options = append(options, uuidcrypt.WithJSONPaths(spec.name))
+			continue
+		}
+		processor, err := newProcessor(cfg.withNamespace(spec.namespace))
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, uuidcrypt.WithJSONPathProcessor(spec.name, processor))
+	}
+	return options, nil
+}
+
+// processValues encrypts or decrypts the UUIDs given as arguments and
+// prints one result per line, in the format of each argument. Nothing
+// is printed if any argument is not a UUID.
+func processValues(cfg Config, w io.Writer) error {
+	if len(cfg.values) == 0 {
+		return withKind(uuidcrypt.ConfigError, ErrNoValues)
+	}
+	processor, err := newProcessor(cfg)
+	if err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	format, err := uuidcrypt.ParseUUIDFormat(cfg.uuidFormat)
+	if err != nil {
+		return withKind(uuidcrypt.ConfigError, err)
+	}
+	uuids := make([]uuid.UUID, len(cfg.values))
+	for i, value := range cfg.values {
+		u, err := uuid.Parse(value)
+		if err != nil {
+			return &uuidcrypt.Error{Kind: uuidcrypt.ParseError, Err: fmt.Errorf("argument %d: %q: %v", i+1, value, err)}
+		}
+		uuids[i] = u
+	}
+	for i, u := range uuidcrypt.ProcessUUIDs(processor, uuids...) {
+		if _, err := fmt.Fprintln(w, format.Format(u, cfg.values[i])); err != nil {
+			return withKind(uuidcrypt.IOError, err)
+		}
+	}
+	return nil
+}
+
+// columnOptions returns the UUIDCrypt options selecting the columns
+// to process, their namespaces, and the context column.
+func columnOptions(cfg Config) ([]uuidcrypt.UUIDCryptOptions, error) {
+	var options []uuidcrypt.UUIDCryptOptions
+	var columns []int
+	if cfg.header {
+		options = append(options, uuidcrypt.WithHeader())
+	}
+	for _, spec := range cfg.columns {
+		if spec.name != "" {
+			options = append(options, uuidcrypt.WithColumnNames(spec.name))
+		} else {
+			columns = append(columns, spec.index)
+		}
+		if spec.namespace == "" {
+			continue
+		}
+		processor, err := newProcessor(cfg.withNamespace(spec.namespace))
+		if err != nil {
+			return nil, err
+		}
+		if spec.name != "" {
+			options = append(options, uuidcrypt.WithNamedColumnProcessor(spec.name, processor))
+		} else {
+			options = append(options, uuidcrypt.WithColumnProcessor(spec.index, processor))
+		}
+	}
+	options = append(options, uuidcrypt.WithColumns(columns...))
+	if cfg.contextColumn.name != "" {
+		options = append(options, uuidcrypt.WithContextColumnName(cfg.contextColumn.name))
+	} else {
+		options = append(options, uuidcrypt.WithContextColumn(cfg.contextColumn.index))
+	}
+	return options, nil
+}
+
+// newProcessor returns the uuidcrypt.Processor described by cfg. When
+// rotating, it decrypts with the current credentials and re-encrypts
+// with the new ones in a single pass.
+func newProcessor(cfg Config) (uuidcrypt.Processor, error) {
+	if !cfg.rotate {
+		return newCrypterProcessor(cfg.key(), cfg.validUUIDs, toCryptType(cfg.decrypt))
+	}
+	if cfg.decrypt {
+		return nil, ErrRotateDecrypt
+	}
+	decrypter, err := newCrypterProcessor(cfg.key(), cfg.validUUIDs, uuidcrypt.DecryptType)
+	if err != nil {
+		return nil, err
+	}
+	encrypter, err := newCrypterProcessor(cfg.newKey(), cfg.validUUIDs, uuidcrypt.EncryptType)
+	if err != nil {
+		return nil, err
+	}
+	return uuidcrypt.NewChainProcessor(decrypter, encrypter), nil
+}
+
+func newCrypterProcessor(key keyConfig, validUUIDs bool, cryptType uuidcrypt.CryptType) (uuidcrypt.Processor, error) {
+	if key.keyring != nil {
+		var options []uuidcrypt.ProcessorOptions
+		if validUUIDs {
+			options = append(options, uuidcrypt.WithValidUUIDs())
+		}
+		return key.keyring.Processor(key.keyID, toBytes(key.namespace), cryptType, options...)
+	}
+	kdf, err := uuidcrypt.ParseKDFVersion(key.kdf)
+	if err != nil {
+		return nil, err
+	}
+	keySize, err := parseKeySize(key.keySize)
+	if err != nil {
+		return nil, err
+	}
+	if err := uuidcrypt.ValidateKeySize(kdf, keySize); err != nil {
+		return nil, err
+	}
+	stretch, err := uuidcrypt.ParseStretch(key.stretch, key.stretchParams)
+	if err != nil {
+		return nil, err
+	}
+	stretch.Salt = toBytes(key.stretchSalt)
+	options := []uuidcrypt.ProcessorOptions{uuidcrypt.WithKDF(kdf), uuidcrypt.WithKeySize(keySize), uuidcrypt.WithStretch(stretch)}
+	if validUUIDs {
+		options = append(options, uuidcrypt.WithValidUUIDs())
+	}
+	return uuidcrypt.NewCrypterProcessor(toBytes(key.secret), toBytes(key.namespace), cryptType, options...), nil
+}
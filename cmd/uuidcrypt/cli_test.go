@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/APTy/uuidcrypt"
+)
+
+const (
+	testSecret    = "foo"
+	testNamespace = "bar"
+
+	testDir             = "../../testdata/"
+	testInputFile       = testDir + "testfile.csv"
+	testEncInputFile    = testDir + "testfile.csv.enc"
+	testOutputFile      = testDir + ".testfile.csv"
+	testOutputFile2     = testDir + ".testfile.csv2"
+	testOutputFile3     = testDir + ".testfile.csv3"
+	testBinaryDelimFile = testDir + "binary-delim.csv"
+)
+
+func failIfError(t *testing.T, err error) {
+	if err != nil {
+		t.Fatalf("encountered error: %v\n", err)
+	}
+}
+
+func assert(t *testing.T, condition bool, description string) {
+	if !condition {
+		t.Fatal(description)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	defer os.Remove(testOutputFile)
+	defer os.Remove(testOutputFile2)
+	defer os.Remove(testOutputFile3)
+
+	// encrypt
+	runCLIWithMockConfig(t, Config{
+		inputFile:  testInputFile,
+		outputFile: testOutputFile,
+		secret:     testSecret,
+		namespace:  testNamespace,
+	})
+
+	// test encrypt success with regression comparison
+	input := getRecordsFromCSV(t, testInputFile)
+	encInput := getRecordsFromCSV(t, testEncInputFile)
+	output := getRecordsFromCSV(t, testOutputFile)
+	assert(t, len(input) == len(encInput), "num input rows should match num encrypted input rows")
+	assert(t, len(input) == len(output), "num input rows should match num output rows")
+	for i := range input {
+		in := input[i]
+		out := output[i]
+		encIn := encInput[i]
+		assert(t, in[0] != out[0], "input uuid should not match output uuid")
+		assert(t, in[1] == out[1], "other input data should match output data")
+		assert(t, in[2] == out[2], "other input data should match output data")
+		assert(t, out[0] == encIn[0], "output uuid should match encrypted input uuid")
+		assert(t, out[1] == encIn[1], "other output data should match encrypted input data")
+		assert(t, out[2] == encIn[2], "other output data should match encrypted input data")
+	}
+
+	// decrypt with correct key
+	runCLIWithMockConfig(t, Config{
+		inputFile:  testOutputFile,
+		outputFile: testOutputFile2,
+		secret:     testSecret,
+		namespace:  testNamespace,
+		decrypt:    true,
+	})
+
+	// test decrypt success
+	output = getRecordsFromCSV(t, testOutputFile2)
+	assert(t, len(input) == len(output), "num input rows should match num output rows")
+	for i := range input {
+		in := input[i]
+		out := output[i]
+		assert(t, in[0] == out[0], "input uuid should match output uuid")
+		assert(t, in[1] == out[1], "other input data should match output data")
+		assert(t, in[2] == out[2], "other input data should match output data")
+	}
+
+	// decrypt with bad key
+	runCLIWithMockConfig(t, Config{
+		inputFile:  testOutputFile,
+		outputFile: testOutputFile3,
+		secret:     testSecret,
+		namespace:  "wrong",
+		decrypt:    true,
+	})
+
+	// test decrypt failure
+	output = getRecordsFromCSV(t, testOutputFile3)
+	assert(t, len(input) == len(output), "num input rows should match num output rows")
+	for i := range input {
+		in := input[i]
+		out := output[i]
+		assert(t, in[0] != out[0], "input uuid should not match output uuid")
+		assert(t, in[1] == out[1], "other input data should match output data")
+		assert(t, in[2] == out[2], "other input data should match output data")
+	}
+}
+
+func runCLIWithMockConfig(t *testing.T, config Config) {
+	cli := NewCLI(newMockConfig(config))
+	code := cli.Run()
+	assert(t, code == ExitOK, fmt.Sprintf("exit code should be %d: %d", ExitOK, code))
+}
+
+func getRecordsFromCSV(t *testing.T, filename string) [][]string {
+	return getRecordsFromCSVWithDelim(t, filename, ',')
+}
+
+func getRecordsFromCSVWithDelim(t *testing.T, filename string, delim rune) [][]string {
+	f, err := os.Open(filename)
+	failIfError(t, err)
+	r := csv.NewReader(f)
+	r.Comma = delim
+	records, err := r.ReadAll()
+	failIfError(t, err)
+	return records
+}
+
+func TestBinaryDelim(t *testing.T) {
+	testOutputFile := testBinaryDelimFile + ".1"
+	expectedOutputFile := testBinaryDelimFile + ".enc"
+	defer os.Remove(testOutputFile)
+
+	// encrypt
+	runCLIWithMockConfig(t, Config{
+		inputFile:  testBinaryDelimFile,
+		outputFile: testOutputFile,
+		secret:     testSecret,
+		namespace:  testNamespace,
+
+		// simulate unescaped strings entered at the command line
+		delimiter:       "\\x01",
+		delimiterOutput: "\\x02",
+	})
+
+	// test encrypt success with regression comparison
+	input := getRecordsFromCSVWithDelim(t, testBinaryDelimFile, '\x01')
+	expectedOutput := getRecordsFromCSVWithDelim(t, expectedOutputFile, '\x02')
+	testOutput := getRecordsFromCSVWithDelim(t, testOutputFile, '\x02')
+	assert(t, len(input) == len(expectedOutput), "num input rows should match num encrypted input rows")
+	assert(t, len(input) == len(testOutput), "num input rows should match num output rows")
+	for i := range input {
+		in := input[i]
+		out := testOutput[i]
+		encIn := expectedOutput[i]
+		assert(t, in[0] != out[0], "input uuid should not match output uuid")
+		assert(t, in[1] == out[1], "other input data should match output data")
+		assert(t, in[2] == out[2], "other input data should match output data")
+		assert(t, out[0] == encIn[0], "output uuid should match encrypted input uuid")
+		assert(t, out[1] == encIn[1], "other output data should match encrypted input data")
+		assert(t, out[2] == encIn[2], "other output data should match encrypted input data")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	defer os.Remove(testOutputFile)
+	defer os.Remove(testOutputFile2)
+
+	// rotate from the old secret to a new secret and key derivation
+	runCLIWithMockConfig(t, Config{
+		inputFile:  testEncInputFile,
+		outputFile: testOutputFile,
+		secret:     testSecret,
+		namespace:  testNamespace,
+		rotate:     true,
+		newSecret:  "new secret",
+		newKDF:     "v2",
+		newKeySize: "256",
+	})
+
+	// decrypt with the new secret
+	runCLIWithMockConfig(t, Config{
+		inputFile:  testOutputFile,
+		outputFile: testOutputFile2,
+		secret:     "new secret",
+		namespace:  testNamespace,
+		kdf:        "v2",
+		keySize:    "256",
+		decrypt:    true,
+	})
+
+	input := getRecordsFromCSV(t, testInputFile)
+	encInput := getRecordsFromCSV(t, testEncInputFile)
+	rotated := getRecordsFromCSV(t, testOutputFile)
+	output := getRecordsFromCSV(t, testOutputFile2)
+	assert(t, len(input) == len(rotated), "num input rows should match num rotated rows")
+	assert(t, len(input) == len(output), "num input rows should match num output rows")
+	for i := range input {
+		assert(t, rotated[i][0] != encInput[i][0], "rotated uuid should not match old encrypted uuid")
+		assert(t, rotated[i][0] != input[i][0], "rotated uuid should not match input uuid")
+		assert(t, output[i][0] == input[i][0], "decrypted rotated uuid should match input uuid")
+		assert(t, output[i][1] == input[i][1], "other input data should match output data")
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	specs, err := parseColumns("1, user_id:users,,3:orgs")
+	failIfError(t, err)
+	expected := []columnSpec{
+		{index: 1},
+		{name: "user_id", namespace: "users"},
+		{index: 3, namespace: "orgs"},
+	}
+	assert(t, len(specs) == len(expected), fmt.Sprintf("should parse %d columns: %v", len(expected), specs))
+	for i := range expected {
+		assert(t, specs[i] == expected[i], fmt.Sprintf("column %d should be %v: %v", i, expected[i], specs[i]))
+	}
+
+	specs, err = parseColumns(`$['a,b'],$["urn:id"]:users,$['it\'s]:x'],events[0].id:orgs`)
+	failIfError(t, err)
+	expected = []columnSpec{
+		{name: `$['a,b']`},
+		{name: `$["urn:id"]`, namespace: "users"},
+		{name: `$['it\'s]:x']`},
+		{name: "events[0].id", namespace: "orgs"},
+	}
+	assert(t, len(specs) == len(expected), fmt.Sprintf("should parse %d selectors: %v", len(expected), specs))
+	for i := range expected {
+		assert(t, specs[i] == expected[i], fmt.Sprintf("selector %d should be %v: %v", i, expected[i], specs[i]))
+	}
+
+	for _, columns := range []string{"-1", "0", "1,0:users"} {
+		_, err = parseColumns(columns)
+		assert(t, err != nil, "should encounter error for column below 1: "+columns)
+	}
+	_, err = parseColumn("0")
+	assert(t, err != nil, "should encounter error for context column 0")
+}
+
+func TestHeaderColumnNames(t *testing.T) {
+	testHeaderFile := testDir + ".header.csv"
+	defer os.Remove(testHeaderFile)
+	defer os.Remove(testOutputFile)
+	defer os.Remove(testOutputFile2)
+
+	input := append([][]string{{"other", "user_id", "data"}}, getRecordsFromCSV(t, testInputFile)...)
+	for _, row := range input[1:] {
+		row[0], row[1] = row[1], row[0]
+	}
+	writeRecordsToCSV(t, testHeaderFile, input)
+
+	runCLIWithMockConfig(t, Config{
+		inputFile:  testHeaderFile,
+		outputFile: testOutputFile,
+		secret:     testSecret,
+		namespace:  testNamespace,
+		columns:    []columnSpec{{name: "user_id"}},
+		header:     true,
+	})
+	runCLIWithMockConfig(t, Config{
+		inputFile:  testOutputFile,
+		outputFile: testOutputFile2,
+		secret:     testSecret,
+		namespace:  testNamespace,
+		columns:    []columnSpec{{name: "user_id"}},
+		header:     true,
+		decrypt:    true,
+	})
+
+	encInput := getRecordsFromCSV(t, testEncInputFile)
+	encrypted := getRecordsFromCSV(t, testOutputFile)
+	output := getRecordsFromCSV(t, testOutputFile2)
+	assert(t, len(input) == len(encrypted), "num input rows should match num encrypted rows")
+	assert(t, len(input) == len(output), "num input rows should match num output rows")
+	for i := range input {
+		assert(t, output[i][1] == input[i][1], "decrypted uuid should match input uuid")
+		if i == 0 {
+			assert(t, encrypted[i][1] == "user_id", "header should be passed through")
+			continue
+		}
+		assert(t, encrypted[i][1] == encInput[i-1][0], "output uuid should match encrypted input uuid")
+	}
+}
+
+func writeRecordsToCSV(t *testing.T, filename string, records [][]string) {
+	f, err := os.Create(filename)
+	failIfError(t, err)
+	defer f.Close()
+	w := csv.NewWriter(f)
+	failIfError(t, w.WriteAll(records))
+}
+
+func TestExitCodes(t *testing.T) {
+	testBadFile := testDir + ".bad.csv"
+	defer os.Remove(testBadFile)
+	defer os.Remove(testOutputFile)
+	writeRecordsToCSV(t, testBadFile, [][]string{{"id"}, {"4a1981ca-94af-481d-8266-58d86cc8199a"}, {"NULL"}})
+
+	for _, tc := range []struct {
+		config Config
+		code   int
+	}{
+		{Config{inputFile: testInputFile, outputFile: testOutputFile, kdf: "v9"}, ExitConfig},
+		{Config{inputFile: testDir + "missing.csv", outputFile: testOutputFile}, ExitIO},
+		{Config{inputFile: testBadFile, outputFile: testOutputFile}, ExitParse},
+	} {
+		code := NewCLI(newMockConfig(tc.config)).Run()
+		assert(t, code == tc.code, fmt.Sprintf("exit code should be %d: %d", tc.code, code))
+	}
+}
+
+func TestInPlace(t *testing.T) {
+	testInPlaceFile := testDir + ".inplace.csv"
+	defer os.Remove(testInPlaceFile)
+	writeRecordsToCSV(t, testInPlaceFile, getRecordsFromCSV(t, testInputFile))
+
+	// a failed run leaves the original untouched and removes the temp file
+	cfg := Config{inputFile: testInPlaceFile, inPlace: true}
+	failIfError(t, setFilesIfInPlace(&cfg))
+	assert(t, filepath.Dir(cfg.outputFile) == filepath.Dir(testInPlaceFile), "temp file should be in the same directory")
+	assert(t, strings.HasSuffix(cfg.outputFile, filepath.Base(testInPlaceFile)), "temp file should keep the extension")
+	failIfError(t, os.WriteFile(cfg.outputFile, []byte("truncated"), 0600))
+	failIfError(t, removeInPlaceFile(cfg))
+	_, err := os.Stat(cfg.outputFile)
+	assert(t, os.IsNotExist(err), "temp file should be removed")
+	input := getRecordsFromCSV(t, testInputFile)
+	assert(t, len(getRecordsFromCSV(t, testInPlaceFile)) == len(input), "original should be untouched")
+
+	// a successful run replaces the original
+	cfg = Config{inputFile: testInPlaceFile, inPlace: true}
+	failIfError(t, setFilesIfInPlace(&cfg))
+	err = uuidcrypt.NewUUIDCrypt(uuidcrypt.NewCSVFile(cfg.inputFile), uuidcrypt.NewCSVFile(cfg.outputFile), uuidcrypt.NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), uuidcrypt.EncryptType)).Run()
+	failIfError(t, err)
+	failIfError(t, commitInPlaceFile(cfg))
+	_, err = os.Stat(cfg.outputFile)
+	assert(t, os.IsNotExist(err), "temp file should be renamed")
+	encInput := getRecordsFromCSV(t, testEncInputFile)
+	output := getRecordsFromCSV(t, testInPlaceFile)
+	for i := range encInput {
+		assert(t, output[i][0] == encInput[i][0], "original should be encrypted in place")
+	}
+}
+
+func TestProcessValues(t *testing.T) {
+	input := getRecordsFromCSV(t, testInputFile)
+	encInput := getRecordsFromCSV(t, testEncInputFile)
+	cfg := Config{command: encryptCommand, secret: testSecret, namespace: testNamespace}
+	for _, row := range input {
+		cfg.values = append(cfg.values, row[0])
+	}
+	var out bytes.Buffer
+	failIfError(t, processValues(cfg, &out))
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert(t, len(lines) == len(input), fmt.Sprintf("should print %d lines: %d", len(input), len(lines)))
+	for i := range lines {
+		assert(t, lines[i] == encInput[i][0], "output uuid should match encrypted input uuid")
+	}
+
+	cfg = Config{command: decryptCommand, decrypt: true, secret: testSecret, namespace: testNamespace, values: lines}
+	out.Reset()
+	failIfError(t, processValues(cfg, &out))
+	assert(t, strings.HasPrefix(out.String(), input[0][0]+"\n"), "decrypted uuid should match input uuid")
+
+	// arguments keep their format unless a canonical format is asked for
+	cfg.values = []string{"{" + strings.ToUpper(lines[0]) + "}"}
+	out.Reset()
+	failIfError(t, processValues(cfg, &out))
+	assert(t, out.String() == "{"+strings.ToUpper(input[0][0])+"}\n", "decrypted uuid should keep its format: "+out.String())
+	cfg.uuidFormat = "canonical"
+	out.Reset()
+	failIfError(t, processValues(cfg, &out))
+	assert(t, out.String() == input[0][0]+"\n", "decrypted uuid should be canonical: "+out.String())
+	cfg.uuidFormat = ""
+
+	cfg.values = []string{input[0][0], "NULL"}
+	out.Reset()
+	err := processValues(cfg, &out)
+	assert(t, uuidcrypt.KindOf(err) == uuidcrypt.ParseError, fmt.Sprintf("should encounter parse error: %v", err))
+	assert(t, out.Len() == 0, "nothing should be printed if any argument is invalid")
+}
+
+func TestJSONFormats(t *testing.T) {
+	testJSONLinesFile := testDir + ".testfile.jsonl"
+	defer os.Remove(testJSONLinesFile)
+	defer os.Remove(testOutputFile)
+	encInput := getRecordsFromCSV(t, testEncInputFile)
+	input := getRecordsFromCSV(t, testInputFile)
+	line := fmt.Sprintf(`{"user": {"id": %q}, "n": 1}`+"\n", input[0][0])
+	failIfError(t, os.WriteFile(testJSONLinesFile, []byte(line), 0600))
+
+	runCLIWithMockConfig(t, Config{
+		inputFile:  testJSONLinesFile,
+		outputFile: testOutputFile,
+		secret:     testSecret,
+		namespace:  testNamespace,
+		format:     jsonlFormat,
+		columns:    []columnSpec{{name: "user.id"}},
+	})
+	output, err := os.ReadFile(testOutputFile)
+	failIfError(t, err)
+	expected := fmt.Sprintf(`{"user": {"id": %q}, "n": 1}`+"\n", encInput[0][0])
+	assert(t, string(output) == expected, "output should match encrypted input: "+string(output))
+
+	// a whole document with every uuid selected
+	runCLIWithMockConfig(t, Config{
+		inputFile:  testJSONLinesFile,
+		outputFile: testOutputFile,
+		secret:     testSecret,
+		namespace:  testNamespace,
+		format:     jsonFormat,
+		allUUIDs:   true,
+	})
+	output, err = os.ReadFile(testOutputFile)
+	failIfError(t, err)
+	assert(t, string(output) == expected, "json output should match encrypted input: "+string(output))
+
+	code := NewCLI(newMockConfig(Config{inputFile: testJSONLinesFile, outputFile: testOutputFile, format: jsonlFormat, columns: []columnSpec{{index: 1}}})).Run()
+	assert(t, code == ExitConfig, "column numbers should be rejected for jsonl")
+	for _, cfg := range []Config{
+		{contextColumn: columnSpec{name: "tenant"}},
+		{header: true},
+		{workers: 4},
+		{maxRecordSize: 1024},
+		{delimiter: ";"},
+		{delimiterOutput: ";"},
+		{rejectFile: testOutputFile2},
+	} {
+		cfg.inputFile, cfg.outputFile, cfg.secret, cfg.format, cfg.columns = testJSONLinesFile, testOutputFile, testSecret, jsonlFormat, []columnSpec{{name: "user.id"}}
+		code := NewCLI(newMockConfig(cfg)).Run()
+		assert(t, code == ExitConfig, fmt.Sprintf("csv-only flags should be rejected for jsonl: %+v", cfg))
+	}
+	code = NewCLI(newMockConfig(Config{inputFile: testInputFile, outputFile: testOutputFile, secret: testSecret, allUUIDs: true})).Run()
+	assert(t, code == ExitConfig, "-all-uuids should be rejected for csv")
+}
+
+func TestTextFormat(t *testing.T) {
+	testTextFile := testDir + ".testfile.log"
+	defer os.Remove(testTextFile)
+	defer os.Remove(testOutputFile)
+	encInput := getRecordsFromCSV(t, testEncInputFile)
+	input := getRecordsFromCSV(t, testInputFile)
+	failIfError(t, os.WriteFile(testTextFile, []byte("user="+input[0][0]+" ok\n"), 0600))
+
+	runCLIWithMockConfig(t, Config{
+		inputFile:  testTextFile,
+		outputFile: testOutputFile,
+		secret:     testSecret,
+		namespace:  testNamespace,
+		format:     textFormat,
+	})
+	output, err := os.ReadFile(testOutputFile)
+	failIfError(t, err)
+	assert(t, string(output) == "user="+encInput[0][0]+" ok\n", "output should match encrypted input: "+string(output))
+	for _, cfg := range []Config{
+		{columns: []columnSpec{{index: 1}}},
+		{contextColumn: columnSpec{name: "tenant"}},
+		{header: true},
+		{workers: 4},
+		{allUUIDs: true},
+		{onError: "skip-row"},
+		{rejectFile: testOutputFile2},
+		{delimiter: ";"},
+		{delimiterOutput: ";"},
+	} {
+		cfg.inputFile, cfg.outputFile, cfg.secret, cfg.format = testTextFile, testOutputFile, testSecret, textFormat
+		code := NewCLI(newMockConfig(cfg)).Run()
+		assert(t, code == ExitConfig, fmt.Sprintf("csv-only flags should be rejected for text: %+v", cfg))
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	testSecretFile := testDir + ".secret"
+	defer os.Remove(testSecretFile)
+	failIfError(t, os.WriteFile(testSecretFile, []byte(testSecret+"\n"), 0600))
+	secret, err := resolveSecret("", false, testSecretFile, -1)
+	failIfError(t, err)
+	assert(t, secret == testSecret, "secret file should be read without its trailing newline: "+secret)
+
+	r, w, err := os.Pipe()
+	failIfError(t, err)
+	w.WriteString(testSecret + "\r\n")
+	w.Close()
+	secret, err = resolveSecret("from-env", false, "", int(r.Fd()))
+	failIfError(t, err)
+	assert(t, secret == testSecret, "secret fd should override the environment: "+secret)
+
+	secret, err = resolveSecret("from-env", false, "", -1)
+	failIfError(t, err)
+	assert(t, secret == "from-env", "secret should default to the environment")
+
+	_, err = resolveSecret(testSecret, true, testSecretFile, -1)
+	assert(t, errors.Is(err, ErrSecretSources), "only one secret source should be allowed")
+	failIfError(t, os.WriteFile(testSecretFile, []byte("\n"), 0600))
+	_, err = resolveSecret("", false, testSecretFile, -1)
+	assert(t, errors.Is(err, ErrEmptySecret), "empty secret files should be rejected")
+
+	r, w, err = os.Pipe()
+	failIfError(t, err)
+	w.WriteString("new secret\n")
+	w.Close()
+	cfg := Config{secret: testSecret}
+	failIfError(t, loadSecrets(&cfg, "", -1, "", int(r.Fd())))
+	assert(t, cfg.secret == testSecret && cfg.newSecret == "new secret", "new secret should be read from its fd: "+cfg.newSecret)
+}
+
+func TestStretch(t *testing.T) {
+	input := getRecordsFromCSV(t, testInputFile)[0][0]
+	encInput := getRecordsFromCSV(t, testEncInputFile)[0][0]
+	process := func(cfg Config, value string) string {
+		cfg.secret, cfg.namespace, cfg.values = testSecret, testNamespace, []string{value}
+		var out bytes.Buffer
+		failIfError(t, processValues(cfg, &out))
+		return strings.TrimSuffix(out.String(), "\n")
+	}
+	scrypt := Config{command: encryptCommand, stretch: "scrypt", stretchParams: "N=16"}
+	encrypted := process(scrypt, input)
+	assert(t, encrypted != encInput, "stretching should change the key")
+
+	// rotate to argon2id, then decrypt
+	rotated := process(Config{command: encryptCommand, rotate: true, stretch: "scrypt", stretchParams: "N=16", newStretch: "argon2id", newStretchParams: "t=1,m=64,p=1"}, encrypted)
+	assert(t, rotated != encrypted, "rotating should change the key")
+	decrypted := process(Config{command: decryptCommand, decrypt: true, stretch: "argon2id", stretchParams: "t=1,m=64,p=1"}, rotated)
+	assert(t, decrypted == input, "decrypted uuid should match input: "+decrypted)
+
+	// rotate to a new salt, then decrypt
+	salted := process(Config{command: encryptCommand, rotate: true, stretch: "scrypt", stretchParams: "N=16", newStretchSalt: "pepper"}, encrypted)
+	assert(t, salted != encrypted, "rotating the salt should change the key")
+	decrypted = process(Config{command: decryptCommand, decrypt: true, stretch: "scrypt", stretchParams: "N=16", stretchSalt: "pepper"}, salted)
+	assert(t, decrypted == input, "decrypted uuid should match input: "+decrypted)
+
+	err := processValues(Config{command: encryptCommand, stretch: "scrypt", stretchParams: "N=3", values: []string{input}}, &bytes.Buffer{})
+	assert(t, uuidcrypt.KindOf(err) == uuidcrypt.ConfigError, fmt.Sprintf("invalid parameters should be a config error: %v", err))
+}
+
+func TestKeyring(t *testing.T) {
+	keyring, err := uuidcrypt.ReadKeyring(strings.NewReader(`{"keys": [
+		{"name": "exports", "version": 1, "secret": "` + testSecret + `", "created": "2023-01-01T00:00:00Z", "status": "decrypt-only"},
+		{"name": "exports", "version": 2, "secret": "rotated", "created": "2024-01-01T00:00:00Z", "status": "active", "kdf": "v2"}
+	]}`))
+	failIfError(t, err)
+	input := getRecordsFromCSV(t, testInputFile)[0][0]
+	encInput := getRecordsFromCSV(t, testEncInputFile)[0][0]
+	process := func(cfg Config, value string) string {
+		cfg.keyring, cfg.namespace, cfg.values = keyring, testNamespace, []string{value}
+		var out bytes.Buffer
+		failIfError(t, processValues(cfg, &out))
+		return strings.TrimSuffix(out.String(), "\n")
+	}
+	decrypted := process(Config{command: decryptCommand, decrypt: true, keyID: "exports:1"}, encInput)
+	assert(t, decrypted == input, "decrypted uuid should match input: "+decrypted)
+
+	// rotate from the decrypt-only key to the latest active one, then decrypt
+	rotated := process(Config{command: encryptCommand, rotate: true, keyID: "exports:1", newKeyID: "exports"}, encInput)
+	assert(t, rotated != encInput, "rotating should change the key")
+	decrypted = process(Config{command: decryptCommand, decrypt: true, keyID: "exports:2"}, rotated)
+	assert(t, decrypted == input, "decrypted uuid should match input: "+decrypted)
+
+	failIfError(t, checkKeyringFlags(func(name string) bool { return name == "n" }))
+	err = checkKeyringFlags(func(name string) bool { return name == "new-stretch" })
+	assert(t, errors.Is(err, ErrKeyringFlag), fmt.Sprintf("key derivation flags should be rejected with a keyring: %v", err))
+
+	err = processValues(Config{command: encryptCommand, keyring: keyring, keyID: "exports:1", values: []string{input}}, &bytes.Buffer{})
+	assert(t, errors.Is(err, uuidcrypt.ErrKeyDecryptOnly), fmt.Sprintf("decrypt-only keys should not encrypt: %v", err))
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/APTy/uuidcrypt"
+)
+
+// RunConfig decides how uuidcrypt will run. Done is called after a
+// successful run, and Abort after a failed one.
+type RunConfig interface {
+	Load() error
+	Config() Config
+	Done() error
+	Abort() error
+}
+
+// Config provides user input to the CLI invocation.
+// TODO: a lot of config could live with UUIDCrypt as opposed to
+//
+//	being so tightly coupled to the CLI.
+type Config struct {
+	inputFile        string
+	outputFile       string
+	secret           string
+	namespace        string
+	kdf              string
+	keySize          string
+	newSecret        string
+	newNamespace     string
+	newKDF           string
+	newKeySize       string
+	stretch          string
+	stretchParams    string
+	stretchSalt      string
+	newStretch       string
+	newStretchParams string
+	newStretchSalt   string
+	keyring          *uuidcrypt.Keyring
+	keyID            string
+	newKeyID         string
+	delimiter        string
+	delimiterOutput  string
+	maxRecordSize    int
+	format           string
+	allUUIDs         bool
+	uuidFormat       string
+	compress         string
+	workers          int
+	columns          []columnSpec
+	contextColumn    columnSpec
+	header           bool
+	onError          string
+	rejectFile       string
+	inPlace          bool
+	decrypt          bool
+	rotate           bool
+	validUUIDs       bool
+	showVersion      bool
+	command          string
+	values           []string
+}
+
+// keyConfig describes how a key is derived. With a keyring, the key
+// is the keyring entry keyID instead.
+type keyConfig struct {
+	keyring       *uuidcrypt.Keyring
+	keyID         string
+	secret        string
+	namespace     string
+	kdf           string
+	keySize       string
+	stretch       string
+	stretchParams string
+	stretchSalt   string
+}
+
+// key returns the current key.
+func (c Config) key() keyConfig {
+	return keyConfig{
+		keyring:       c.keyring,
+		keyID:         c.keyID,
+		secret:        c.secret,
+		namespace:     c.namespace,
+		kdf:           c.kdf,
+		keySize:       c.keySize,
+		stretch:       c.stretch,
+		stretchParams: c.stretchParams,
+		stretchSalt:   c.stretchSalt,
+	}
+}
+
+// newKey returns the key to re-encrypt with when rotating, which
+// defaults to the current key. The stretching parameters only default
+// to the current ones if the stretching algorithm does.
+func (c Config) newKey() keyConfig {
+	key := keyConfig{
+		keyring:       c.keyring,
+		keyID:         stringOrDefault(c.newKeyID, c.keyID),
+		secret:        stringOrDefault(c.newSecret, c.secret),
+		namespace:     stringOrDefault(c.newNamespace, c.namespace),
+		kdf:           stringOrDefault(c.newKDF, c.kdf),
+		keySize:       stringOrDefault(c.newKeySize, c.keySize),
+		stretch:       c.newStretch,
+		stretchParams: c.newStretchParams,
+		stretchSalt:   stringOrDefault(c.newStretchSalt, c.stretchSalt),
+	}
+	if key.stretch == "" {
+		key.stretch = c.stretch
+		key.stretchParams = stringOrDefault(c.newStretchParams, c.stretchParams)
+	}
+	return key
+}
+
+// withNamespace returns a copy of the config that uses namespace for
+// both the current and, when rotating, the new credentials.
+func (c Config) withNamespace(namespace string) Config {
+	c.namespace = namespace
+	c.newNamespace = namespace
+	return c
+}
+
+type flagConfig struct {
+	config Config
+}
+
+func NewFlagConfig() RunConfig {
+	return &flagConfig{}
+}
+
+func (c *flagConfig) Load() error {
+	cfg := defaultFlagsFromEnv()
+	var columns, contextColumn, secretFile, newSecretFile string
+	var secretFD, newSecretFD int
+	keyringFile := os.Getenv("UUIDCRYPT_KEYRING")
+	stringVarIfNoDefault(&cfg.secret, "s", "Secret key used to generate all encryption keys")
+	flag.StringVar(&secretFile, "secret-file", "", "File to read the secret key from, instead of -s")
+	flag.IntVar(&secretFD, "secret-fd", -1, "File descriptor to read the secret key from, instead of -s")
+	stringVarIfNoDefault(&keyringFile, "keyring", "JSON keyring file of named, versioned secret keys to use instead of -s")
+	stringVarIfNoDefault(&cfg.keyID, "key-id", "Key in the -keyring to use, as name for its latest active version or name:version, which decrypting requires")
+	flag.StringVar(&cfg.newKeyID, "new-key-id", "", "Key in the -keyring to re-encrypt with when rotating (default: -key-id)")
+	stringVarIfNoDefault(&cfg.namespace, "n", "Namespace to generate an entity-specific encryption key")
+	stringVarIfNoDefault(&cfg.kdf, "kdf", "Key derivation scheme, v1 (HMAC-MD5) or v2 (HKDF-SHA256) (default: v1)")
+	stringVarIfNoDefault(&cfg.keySize, "key-size", "AES key size in bits, 128, 192 or 256 (default: 128)")
+	stringVarIfNoDefault(&cfg.newSecret, "new-s", "New secret key to re-encrypt with when rotating (default: -s)")
+	flag.StringVar(&newSecretFile, "new-secret-file", "", "File to read the new secret key from, instead of -new-s")
+	flag.IntVar(&newSecretFD, "new-secret-fd", -1, "File descriptor to read the new secret key from, instead of -new-s")
+	stringVarIfNoDefault(&cfg.newNamespace, "new-n", "New namespace to re-encrypt with when rotating (default: -n)")
+	stringVarIfNoDefault(&cfg.stretch, "stretch", "Passphrase stretching of the secret key before key derivation, none, scrypt or argon2id (default: none)")
+	stringVarIfNoDefault(&cfg.stretchParams, "stretch-params", "Stretching cost parameters, e.g. N=32768,r=8,p=1 for scrypt or t=3,m=65536,p=4 for argon2id (default: those)")
+	stringVarIfNoDefault(&cfg.stretchSalt, "stretch-salt", "Salt to stretch the secret key with (default: the namespace)")
+	flag.StringVar(&cfg.newStretch, "new-stretch", "", "New passphrase stretching to re-encrypt with when rotating (default: -stretch)")
+	flag.StringVar(&cfg.newStretchParams, "new-stretch-params", "", "New stretching cost parameters to re-encrypt with when rotating (default: -stretch-params)")
+	flag.StringVar(&cfg.newStretchSalt, "new-stretch-salt", "", "New salt to stretch the secret key with when rotating (default: -stretch-salt)")
+	flag.StringVar(&cfg.newKDF, "new-kdf", "", "New key derivation scheme to re-encrypt with when rotating (default: -kdf)")
+	flag.StringVar(&cfg.newKeySize, "new-key-size", "", "New AES key size to re-encrypt with when rotating (default: -key-size)")
+	flag.StringVar(&cfg.delimiter, "F", "", "Field separator for CSV file (default: ',')")
+	flag.StringVar(&cfg.delimiterOutput, "OF", "", "Field separator for output CSV file (default: ',')")
+	flag.IntVar(&cfg.maxRecordSize, "max-record-size", 0, "Maximum size of a CSV record in bytes (default: unlimited)")
+	flag.StringVar(&cfg.format, "format", "", "Input and output format, csv, json, jsonl or text (default: csv)")
+	flag.BoolVar(&cfg.allUUIDs, "all-uuids", false, "With -format json or jsonl, process every string value that is a UUID")
+	flag.StringVar(&cfg.uuidFormat, "uuid-format", "", "Format of output UUIDs, preserve (the format of each input UUID) or canonical (default: preserve)")
+	flag.StringVar(&columns, "c", "", "Comma-separated list of columns to encrypt/decrypt, by number or by name with -header, or by field path or JSONPath with -format json or jsonl, each optionally followed by ':namespace' (default: 1)")
+	flag.StringVar(&contextColumn, "context", "", "Column whose value, e.g. a tenant ID, each row's encryption is bound to")
+	flag.BoolVar(&cfg.header, "header", false, "Treat the first row as a header and pass it through untouched")
+	flag.StringVar(&cfg.onError, "on-error", "", "What to do with rows that cannot be processed: strict, passthrough, blank, skip-row or reject-file (default: strict)")
+	flag.StringVar(&cfg.rejectFile, "reject-file", "", "File to write rejected rows to, with their line numbers, for -on-error reject-file")
+	flag.StringVar(&cfg.outputFile, "o", "-", "Output file")
+	flag.StringVar(&cfg.compress, "compress", "", "Compression of the output file, auto (by its extension, .gz or .zst), none, gzip or zstd (default: auto)")
+	flag.BoolVar(&cfg.decrypt, "d", false, "Set operation to DECRYPT (default: ENCRYPT)")
+	flag.BoolVar(&cfg.rotate, "rotate", false, "Set operation to ROTATE: decrypt with -s/-n and re-encrypt with -new-s/-new-n")
+	flag.BoolVar(&cfg.inPlace, "i", false, "Operate on the file in-place")
+	flag.IntVar(&cfg.workers, "j", 1, "Number of workers to process the rows of a CSV file with in parallel, keeping their order")
+	flag.BoolVar(&cfg.validUUIDs, "valid-uuid", false, "Preserve UUID version and variant bits so output UUIDs stay valid")
+	flag.BoolVar(&cfg.showVersion, "version", false, "Display version information")
+	flag.Usage = usage
+	args := os.Args[1:]
+	if len(args) > 0 && isCommand(args[0]) {
+		cfg.command = args[0]
+		cfg.decrypt = cfg.command == decryptCommand
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if keyringFile != "" {
+		if err := loadKeyring(&cfg, keyringFile, secretFile, secretFD, newSecretFile, newSecretFD); err != nil {
+			return err
+		}
+	} else if err := loadSecrets(&cfg, secretFile, secretFD, newSecretFile, newSecretFD); err != nil {
+		return err
+	}
+	if specs, err := parseColumns(columns); err != nil {
+		return err
+	} else {
+		cfg.columns = specs
+	}
+	if spec, err := parseColumn(contextColumn); err != nil {
+		return err
+	} else {
+		cfg.contextColumn = spec
+	}
+	if cfg.command != "" {
+		cfg.values = flag.Args()
+		c.config = cfg
+		return nil
+	}
+	cfg.inputFile = flag.Arg(0)
+	if cfg.inputFile == "" {
+		cfg.inputFile = uuidcrypt.StdPipe
+	}
+	if err := setFilesIfInPlace(&cfg); err != nil {
+		return withKind(uuidcrypt.IOError, err)
+	}
+	c.config = cfg
+	return nil
+}
+
+// Formats of the input and output files.
+const (
+	csvFormat   = "csv"
+	jsonFormat  = "json"
+	jsonlFormat = "jsonl"
+	textFormat  = "text"
+)
+
+// loadSecrets reads the secrets from the flags, files or file
+// descriptor they were given with. If no secret was given, it is
+// prompted for on the terminal.
+func loadSecrets(cfg *Config, secretFile string, secretFD int, newSecretFile string, newSecretFD int) error {
+	secret, err := resolveSecret(cfg.secret, warnIfSecretFlag("s", "-secret-file, -secret-fd or UUIDCRYPT_SECRET"), secretFile, secretFD)
+	if err != nil {
+		return err
+	}
+	newSecret, err := resolveSecret(cfg.newSecret, warnIfSecretFlag("new-s", "-new-secret-file, -new-secret-fd or UUIDCRYPT_NEW_SECRET"), newSecretFile, newSecretFD)
+	if err != nil {
+		return err
+	}
+	if secret == "" && !cfg.showVersion {
+		if secret, err = promptSecret("Secret: "); err != nil {
+			return err
+		}
+	}
+	cfg.secret, cfg.newSecret = secret, newSecret
+	return nil
+}
+
+// loadKeyring reads the keyring that keys are taken from instead of
+// secrets, which may then not be given as well.
+func loadKeyring(cfg *Config, keyringFile, secretFile string, secretFD int, newSecretFile string, newSecretFD int) error {
+	if isFlagSet("s") || isFlagSet("new-s") || secretFile != "" || secretFD >= 0 || newSecretFile != "" || newSecretFD >= 0 {
+		return ErrKeyringSecret
+	}
+	if err := checkKeyringFlags(isFlagSet); err != nil {
+		return err
+	}
+	if cfg.keyID == "" && !cfg.showVersion {
+		return ErrNoKeyID
+	}
+	keyring, err := uuidcrypt.LoadKeyring(keyringFile)
+	if err != nil {
+		return err
+	}
+	cfg.keyring = keyring
+	return nil
+}
+
+// keyringFlags are the flags describing how keys are derived, which
+// the entries of a keyring describe instead.
+var keyringFlags = []string{
+	"kdf", "key-size", "stretch", "stretch-params", "stretch-salt",
+	"new-kdf", "new-key-size", "new-stretch", "new-stretch-params", "new-stretch-salt",
+}
+
+// checkKeyringFlags rejects the first of keyringFlags that was set,
+// rather than silently ignoring it.
+func checkKeyringFlags(isSet func(name string) bool) error {
+	for _, name := range keyringFlags {
+		if isSet(name) {
+			return fmt.Errorf("%w: -%s", ErrKeyringFlag, name)
+		}
+	}
+	return nil
+}
+
+// Commands that operate on UUIDs given as arguments instead of on a
+// CSV file.
+const (
+	encryptCommand = "encrypt"
+	decryptCommand = "decrypt"
+)
+
+func isCommand(arg string) bool {
+	return arg == encryptCommand || arg == decryptCommand
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: uuidcrypt [flags] [file]\n")
+	fmt.Fprintf(out, "       uuidcrypt encrypt|decrypt [flags] <uuid>...\n")
+	flag.PrintDefaults()
+}
+
+func (c *flagConfig) Config() Config {
+	return c.config
+}
+
+func (c *flagConfig) Done() error {
+	return commitInPlaceFile(c.config)
+}
+
+func (c *flagConfig) Abort() error {
+	return removeInPlaceFile(c.config)
+}
+
+func defaultFlagsFromEnv() Config {
+	var c Config
+	c.secret = os.Getenv("UUIDCRYPT_SECRET")
+	c.namespace = os.Getenv("UUIDCRYPT_NAMESPACE")
+	c.kdf = os.Getenv("UUIDCRYPT_KDF")
+	c.keySize = os.Getenv("UUIDCRYPT_KEY_SIZE")
+	c.newSecret = os.Getenv("UUIDCRYPT_NEW_SECRET")
+	c.newNamespace = os.Getenv("UUIDCRYPT_NEW_NAMESPACE")
+	c.stretch = os.Getenv("UUIDCRYPT_STRETCH")
+	c.stretchParams = os.Getenv("UUIDCRYPT_STRETCH_PARAMS")
+	c.stretchSalt = os.Getenv("UUIDCRYPT_STRETCH_SALT")
+	c.keyID = os.Getenv("UUIDCRYPT_KEY_ID")
+	return c
+}
+
+func stringVarIfNoDefault(s *string, name, description string) {
+	currentValue := *s
+	defaultValue := ""
+	flag.StringVar(s, name, defaultValue, description)
+	if *s == defaultValue {
+		*s = currentValue
+	}
+}
+
+func stringOrDefault(str, defaultValue string) string {
+	if str == "" {
+		return defaultValue
+	}
+	return str
+}
+
+func toBytes(str string) []byte {
+	return []byte(str)
+}
+
+func toCryptType(shouldDecrypt bool) uuidcrypt.CryptType {
+	if shouldDecrypt {
+		return uuidcrypt.DecryptType
+	}
+	return uuidcrypt.EncryptType
+}
+
+func parseKeySize(keySize string) (int, error) {
+	if keySize == "" {
+		return uuidcrypt.DefaultKeySize, nil
+	}
+	return strconv.Atoi(keySize)
+}
+
+// setFilesIfInPlace writes the output to a temporary file in the same
+// directory as the input. The temporary file replaces the input only
+// once the run succeeds, see commitInPlaceFile.
+func setFilesIfInPlace(c *Config) error {
+	if !c.inPlace {
+		return nil
+	}
+	if c.inputFile == uuidcrypt.StdPipe {
+		c.outputFile = uuidcrypt.StdPipe
+		return nil
+	}
+	tempFile, err := createTempFile(c.inputFile)
+	if err != nil {
+		return err
+	}
+	c.outputFile = tempFile
+	return nil
+}
+
+// createTempFile creates an empty temporary file next to filename.
+// Its name ends with the base name of filename so that it keeps the
+// same extension.
+func createTempFile(filename string) (string, error) {
+	dir, base := filepath.Split(filename)
+	f, err := os.CreateTemp(dir, ".uuidcrypt-*-"+base)
+	if err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// commitInPlaceFile flushes the temporary output file to disk and
+// atomically renames it over the input file.
+func commitInPlaceFile(c Config) error {
+	if !c.inPlace || c.inputFile == uuidcrypt.StdPipe {
+		return nil
+	}
+	if err := syncFile(c.outputFile, c.inputFile); err != nil {
+		os.Remove(c.outputFile)
+		return err
+	}
+	if err := os.Rename(c.outputFile, c.inputFile); err != nil {
+		os.Remove(c.outputFile)
+		return err
+	}
+	return syncDir(filepath.Dir(c.inputFile))
+}
+
+// removeInPlaceFile removes the temporary output file, leaving the
+// input file untouched.
+func removeInPlaceFile(c Config) error {
+	if !c.inPlace || c.inputFile == uuidcrypt.StdPipe {
+		return nil
+	}
+	return os.Remove(c.outputFile)
+}
+
+// syncFile gives filename the permissions of original and flushes it
+// to disk.
+func syncFile(filename, original string) error {
+	info, err := os.Stat(original)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// columnSpec is a column given on the command line, either by its
+// 1-based number or by its name in the header row.
+type columnSpec struct {
+	index     int
+	name      string
+	namespace string
+}
+
+// parseColumns parses a list of columns such as "1,user_id:users,3".
+// A column may be followed by a colon and the namespace to use for it
+// instead of the default namespace. Commas and colons within brackets,
+// such as in the JSONPath selector `$['urn:id']`, do not separate
+// columns or namespaces.
+func parseColumns(columns string) ([]columnSpec, error) {
+	var specs []columnSpec
+	for rest, more := columns, true; more; {
+		var col string
+		col, rest, more = cutColumns(rest, ',')
+		col, namespace, _ := cutColumns(col, ':')
+		spec, err := parseColumn(col)
+		if err != nil {
+			return nil, err
+		}
+		if spec == (columnSpec{}) {
+			continue
+		}
+		spec.namespace = namespace
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// cutColumns is like strings.Cut, but skips any sep within brackets,
+// including within quoted strings there, which may escape a quote with
+// a backslash.
+func cutColumns(s string, sep byte) (before, after string, found bool) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case depth > 0 && (c == '\'' || c == '"'):
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		case c == sep && depth == 0:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// parseColumn parses a single column number or name. Columns are
+// numbered from 1, and an empty column is the zero columnSpec.
+func parseColumn(column string) (columnSpec, error) {
+	column = strings.TrimSpace(column)
+	if index, err := strconv.Atoi(column); err == nil {
+		if index < 1 {
+			return columnSpec{}, fmt.Errorf("invalid column: %d", index)
+		}
+		return columnSpec{index: index}, nil
+	}
+	return columnSpec{name: column}, nil
+}
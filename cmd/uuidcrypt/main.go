@@ -0,0 +1,9 @@
+// Command uuidcrypt encrypts and decrypts the UUIDs in CSV files.
+package main
+
+import "os"
+
+func main() {
+	cli := NewCLI(NewFlagConfig())
+	os.Exit(cli.Run())
+}
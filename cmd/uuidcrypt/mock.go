@@ -19,3 +19,7 @@ func (c *mockConfig) Config() Config {
 func (c *mockConfig) Done() error {
 	return nil
 }
+
+func (c *mockConfig) Abort() error {
+	return nil
+}
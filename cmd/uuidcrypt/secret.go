@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var (
+	ErrSecretSources = errors.New("cli: a secret may only be given once, as a flag, a file or a file descriptor")
+	ErrEmptySecret   = errors.New("cli: secret is empty")
+	ErrNoSecret      = errors.New("cli: no secret given, and no terminal to prompt for one")
+	ErrKeyringSecret = errors.New("cli: a secret may not be given with -keyring")
+	ErrNoKeyID       = errors.New("cli: -key-id is required with -keyring")
+	ErrKeyringFlag   = errors.New("cli: key derivation flags may not be given with -keyring")
+)
+
+// resolveSecret returns the secret from whichever one of -s, a file
+// or a file descriptor was given, or else secret as is, e.g. from the
+// environment. A negative fd means none was given.
+func resolveSecret(secret string, secretSet bool, file string, fd int) (string, error) {
+	sources := 0
+	for _, given := range []bool{secretSet, file != "", fd >= 0} {
+		if given {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", ErrSecretSources
+	}
+	switch {
+	case file != "":
+		return readSecretFile(file)
+	case fd >= 0:
+		return readSecret(os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd)))
+	}
+	return secret, nil
+}
+
+func readSecretFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	return readSecret(f)
+}
+
+// readSecret reads a secret from f and closes it. A single trailing
+// newline is not part of the secret.
+func readSecret(f *os.File) (string, error) {
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return "", fmt.Errorf("read secret from %s: %w", f.Name(), err)
+	}
+	secret := strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r")
+	if secret == "" {
+		return "", ErrEmptySecret
+	}
+	return secret, nil
+}
+
+// promptSecret asks for the secret on the terminal, without echoing
+// it.
+func promptSecret(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", ErrNoSecret
+	}
+	defer tty.Close()
+	if !term.IsTerminal(int(tty.Fd())) {
+		return "", ErrNoSecret
+	}
+	fmt.Fprint(tty, prompt)
+	b, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		return "", err
+	}
+	if len(b) == 0 {
+		return "", ErrEmptySecret
+	}
+	return string(b), nil
+}
+
+// warnIfSecretFlag warns that secrets given as flags are exposed to
+// other users, suggesting the alternatives to the flag, and reports
+// whether the flag was given.
+func warnIfSecretFlag(name, alternatives string) bool {
+	set := isFlagSet(name)
+	if set {
+		fmt.Fprintf(os.Stderr, "warning: -%s exposes the secret in the process list and shell history; use %s instead\n", name, alternatives)
+	}
+	return set
+}
+
+// isFlagSet reports whether the named flag was given on the command
+// line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
@@ -0,0 +1,198 @@
+package uuidcrypt
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	ErrUnknownCompression = errors.New("compress: unknown compression")
+)
+
+// Compression is the compression of an input or output file.
+type Compression int
+
+const (
+	// AutoCompression compresses output files whose names end in .gz
+	// with gzip and those whose names end in .zst with zstd.
+	AutoCompression Compression = 1 + iota
+
+	// NoCompression writes output files as is.
+	NoCompression
+
+	// GzipCompression compresses output files with gzip.
+	GzipCompression
+
+	// ZstdCompression compresses output files with zstd.
+	ZstdCompression
+)
+
+// ParseCompression returns the Compression named by str: "auto",
+// "none", "gzip" or "zstd". An empty string means AutoCompression.
+func ParseCompression(str string) (Compression, error) {
+	switch str {
+	case "", "auto":
+		return AutoCompression, nil
+	case "none":
+		return NoCompression, nil
+	case "gzip":
+		return GzipCompression, nil
+	case "zstd":
+		return ZstdCompression, nil
+	}
+	return 0, ErrUnknownCompression
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressionOf returns the compression of the named file by its
+// extension.
+func compressionOf(filename string) Compression {
+	switch {
+	case strings.HasSuffix(filename, ".gz"):
+		return GzipCompression
+	case strings.HasSuffix(filename, ".zst"):
+		return ZstdCompression
+	}
+	return NoCompression
+}
+
+// decompress returns a reader of the decompressed contents of file if
+// they start with the gzip or zstd magic bytes, or of file as is.
+func decompress(file io.ReadCloser) (io.ReadCloser, error) {
+	r := bufio.NewReader(file)
+	magic, err := r.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return &compressedReader{Reader: zr, closers: []io.Closer{zr, file}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return &compressedReader{Reader: zr, closers: []io.Closer{zr.IOReadCloser(), file}}, nil
+	}
+	return &compressedReader{Reader: r, closers: []io.Closer{file}}, nil
+}
+
+// compress returns a writer that compresses to file.
+func compress(file io.WriteCloser, compression Compression) (io.WriteCloser, error) {
+	switch compression {
+	case GzipCompression:
+		return &compressedWriter{WriteCloser: gzip.NewWriter(file), file: file}, nil
+	case ZstdCompression:
+		zw, err := zstd.NewWriter(file)
+		if err != nil {
+			return nil, err
+		}
+		return &compressedWriter{WriteCloser: zw, file: file}, nil
+	}
+	return file, nil
+}
+
+// compressedReader reads from a decompressor, closing it along with
+// the underlying file.
+type compressedReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *compressedReader) Close() error {
+	var errs []error
+	for _, c := range r.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// compressedWriter writes to a compressor, flushing it before closing
+// the underlying file.
+type compressedWriter struct {
+	io.WriteCloser
+	file io.WriteCloser
+}
+
+func (w *compressedWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// OpenFile opens the named file for reading, or stdin if the name is
+// StdPipe. Files compressed with gzip or zstd are decompressed as they
+// are read.
+func OpenFile(filename string) (io.ReadCloser, error) {
+	var file io.ReadCloser = os.Stdin
+	if filename != StdPipe {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		file = f
+	}
+	r, err := decompress(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return namedReader{r, filename}, nil
+}
+
+// namedReader is a decompressed file that keeps the name it was opened
+// with, so that errors reading it can be reported against it.
+type namedReader struct {
+	io.ReadCloser
+	name string
+}
+
+func (r namedReader) Name() string {
+	return r.name
+}
+
+// CreateFile creates the named file for writing, or returns stdout if
+// the name is StdPipe. Files whose names end in .gz or .zst are
+// compressed with gzip or zstd.
+func CreateFile(filename string) (io.WriteCloser, error) {
+	return CreateCompressedFile(filename, AutoCompression)
+}
+
+// CreateCompressedFile is like CreateFile, but compresses the file as
+// specified instead of by its name.
+func CreateCompressedFile(filename string, compression Compression) (io.WriteCloser, error) {
+	var file io.WriteCloser = os.Stdout
+	if filename != StdPipe {
+		f, err := os.Create(filename)
+		if err != nil {
+			return nil, err
+		}
+		file = f
+	}
+	if compression == AutoCompression {
+		compression = compressionOf(filename)
+	}
+	w, err := compress(file, compression)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
@@ -0,0 +1,57 @@
+package uuidcrypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressedFiles(t *testing.T) {
+	dir := t.TempDir()
+	rows := [][]string{{testUUID}, {testUUID2}}
+	for _, tt := range []struct {
+		name        string
+		compression Compression
+		magic       []byte
+	}{
+		{"out.csv.gz", AutoCompression, gzipMagic},
+		{"out.csv.zst", AutoCompression, zstdMagic},
+		{"out.csv", AutoCompression, nil},
+		{"out.gzip.csv", GzipCompression, gzipMagic},
+		{"out.zstd.csv", ZstdCompression, zstdMagic},
+		{"plain.csv.gz", NoCompression, nil},
+	} {
+		filename := filepath.Join(dir, tt.name)
+		err := NewUUIDCrypt(&memFile{rows: rows}, NewCSVFile(filename, WithCompression(tt.compression)), newTestProcessor(testNamespace, EncryptType)).Run()
+		failIfError(t, err)
+		b, err := os.ReadFile(filename)
+		failIfError(t, err)
+		if tt.magic == nil {
+			assert(t, !bytes.HasPrefix(b, gzipMagic) && !bytes.HasPrefix(b, zstdMagic), tt.name+": should not be compressed")
+		} else {
+			assert(t, bytes.HasPrefix(b, tt.magic), tt.name+": should be compressed")
+		}
+
+		output := &memFile{}
+		err = NewUUIDCrypt(NewCSVFile(filename), output, newTestProcessor(testNamespace, DecryptType)).Run()
+		failIfError(t, err)
+		assert(t, len(output.rows) == 2 && output.rows[0][0] == testUUID && output.rows[1][0] == testUUID2, tt.name+": decrypted rows should match input")
+	}
+}
+
+func TestOpenEmptyFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "empty.csv")
+	failIfError(t, os.WriteFile(filename, nil, 0600))
+	r, err := OpenFile(filename)
+	failIfError(t, err)
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	failIfError(t, err)
+	assert(t, len(b) == 0, "empty file should be read as empty")
+
+	_, err = ParseCompression("bzip2")
+	assert(t, errors.Is(err, ErrUnknownCompression), "expected unknown compression error")
+}
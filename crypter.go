@@ -0,0 +1,65 @@
+package uuidcrypt
+
+import "github.com/google/uuid"
+
+// Crypter encrypts and decrypts individual UUIDs. It produces the
+// same results as a UUIDCrypt using a NewCrypterProcessor with the
+// same secret, namespace and options, so that services can encrypt
+// and decrypt UUIDs consistently with files processed by uuidcrypt.
+type Crypter struct {
+	encrypter Processor
+	decrypter Processor
+}
+
+// NewCrypter returns a Crypter for the secret and namespace. Unlike
+// NewCrypterProcessor, it returns an error if the options describe a
+// key that cannot be derived.
+func NewCrypter(secret, namespace []byte, options ...ProcessorOptions) (*Crypter, error) {
+	encrypter, err := newCrypterProcessor(secret, namespace, EncryptType, options...)
+	if err != nil {
+		return nil, err
+	}
+	// reuse the stretched secret, rather than stretching it again.
+	decrypter, err := newCrypterProcessor(encrypter.secret, namespace, DecryptType, encrypter.options...)
+	if err != nil {
+		return nil, err
+	}
+	return &Crypter{
+		encrypter: encrypter,
+		decrypter: decrypter,
+	}, nil
+}
+
+// Encrypt returns the encrypted form of u.
+func (c *Crypter) Encrypt(u uuid.UUID) uuid.UUID {
+	return ProcessUUID(c.encrypter, u)
+}
+
+// Decrypt returns the decrypted form of u.
+func (c *Crypter) Decrypt(u uuid.UUID) uuid.UUID {
+	return ProcessUUID(c.decrypter, u)
+}
+
+// ProcessUUID runs the processor over a single UUID, such as one
+// returned by NewCrypterProcessor.
+func ProcessUUID(p Processor, u uuid.UUID) uuid.UUID {
+	var out uuid.UUID
+	copy(out[:], p.Process(u[:]))
+	return out
+}
+
+// ProcessUUIDs runs the processor over each of the UUIDs, returning
+// the results in the same order. The UUIDs are processed with a single
+// call to ProcessBatch.
+func ProcessUUIDs(p Processor, uuids ...uuid.UUID) []uuid.UUID {
+	buf := make([]byte, len(uuids)*uuidSize)
+	for i, u := range uuids {
+		copy(buf[i*uuidSize:], u[:])
+	}
+	ProcessBatch(p, buf, buf)
+	out := make([]uuid.UUID, len(uuids))
+	for i := range out {
+		copy(out[i][:], buf[i*uuidSize:])
+	}
+	return out
+}
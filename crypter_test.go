@@ -0,0 +1,23 @@
+package uuidcrypt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCrypter(t *testing.T) {
+	crypter, err := NewCrypter([]byte(testSecret), []byte(testNamespace))
+	failIfError(t, err)
+	in := uuid.MustParse(testUUID)
+	out := crypter.Encrypt(in)
+
+	// regression comparison with testdata/testfile.csv.enc
+	expected := uuid.MustParse("14b30ccf-fab7-47dd-7478-9175c82a8e74")
+	assert(t, out == expected, fmt.Sprintf("encrypted uuid should be %s: %s", expected, out))
+	assert(t, crypter.Decrypt(out) == in, "decrypted uuid should match input")
+
+	_, err = NewCrypter([]byte(testSecret), []byte(testNamespace), WithKeySize(256))
+	assert(t, err == ErrUnsupportedKeySize, fmt.Sprintf("should encounter error: %v", ErrUnsupportedKeySize))
+}
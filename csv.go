@@ -1,122 +1,308 @@
-package main
+package uuidcrypt
 
 import (
 	"bufio"
-	"encoding/csv"
+	"bytes"
 	"errors"
 	"io"
-	"strconv"
 	"strings"
 )
 
 var (
-	ErrBadColumnLength = errors.New("csv: bad column length")
+	ErrBadColumnLength   = errors.New("csv: bad column length")
+	ErrUnterminatedQuote = errors.New("csv: unterminated quoted field")
+	ErrRecordTooLong     = errors.New("csv: record too long")
 )
 
+// readErrorKind classifies an error returned when reading a record.
+func readErrorKind(err error) ErrorKind {
+	switch {
+	case errors.Is(err, ErrBadColumnLength),
+		errors.Is(err, ErrUnterminatedQuote),
+		errors.Is(err, ErrRecordTooLong):
+		return ParseError
+	}
+	return IOError
+}
+
 // CSVReader encapsulates reading of CSV files to better customize
 // how parsing occurs.
 type CSVReader interface {
 	Read() ([]string, error)
 }
 
-// NewCSVReader returns a CSVReader using a combination of the
-// encoding/csv reader and the strings.split() method.
+// NewCSVReader returns a CSVReader that parses RFC 4180 CSV records
+// as a stream. Quoted fields may contain delimiters and newlines.
 //
 // It supports double quotes that are escaped by placing two
 // double-quotes next to each other.
-// 	e.g. `"i am ""tyler"""` is interpreted as `i am "tyler"`
+//
+//	e.g. `"i am ""tyler"""` is interpreted as `i am "tyler"`
 //
 // It also supports double quotes that are escaped by placing
 // a backslash before the double quote character.
-// 	e.g. `"i am \"tyler\""` is interpreted as `i am "tyler"`
+//
+//	e.g. `"i am \"tyler\""` is interpreted as `i am "tyler"`
+//
+// A backslash only escapes a double quote that does not close the
+// field, i.e. one that is not followed by a delimiter, a newline or
+// the end of the input, so `"C:\"` is interpreted as `C:\`. Any other
+// backslash is kept as is. Quotes within unquoted fields are kept as
+// is, and blank lines are skipped.
+//
+// Fields are read as bytes, so text that is not valid UTF-8, e.g.
+// Latin-1, is kept as is. Records may be of any size. Errors from the
+// underlying reader are returned as is, so io.EOF is only returned at
+// the end of the input.
 func NewCSVReader(r io.Reader, delimiter rune) CSVReader {
+	return NewCSVReaderSize(r, delimiter, 0)
+}
+
+// NewCSVReaderSize is like NewCSVReader, but returns ErrRecordTooLong
+// when a record is larger than maxRecordSize bytes. A maxRecordSize of
+// zero means records may be of any size.
+func NewCSVReaderSize(r io.Reader, delimiter rune, maxRecordSize int) CSVReader {
 	return &csvReader{
-		r:         bufio.NewScanner(r),
-		delimiter: delimiter,
+		r:             bufio.NewReader(r),
+		delimiter:     []byte(string(delimiter)),
+		maxRecordSize: maxRecordSize,
 	}
 }
 
 type csvReader struct {
-	r          *bufio.Scanner
-	delimiter  rune
-	numColumns uint
+	r             *bufio.Reader
+	delimiter     []byte
+	numColumns    uint
+	field         strings.Builder
+	maxRecordSize int
+	recordSize    int
+	lastByte      byte
+	line          int
+	recordLine    int
 }
 
 func (r *csvReader) Read() ([]string, error) {
-	line, err := r.readLine()
+	columns, err := r.readRecord()
 	if err != nil {
 		return nil, err
 	}
-	columns := strings.Split(line, string(r.delimiter))
 	if err := r.validateNumColumns(len(columns)); err != nil {
 		return nil, err
 	}
-	for i := range columns {
-		columns[i] = r.unquoteIfNeeded(columns[i])
-	}
 	return columns, nil
 }
 
-func (r *csvReader) readLine() (string, error) {
-	if r.r.Scan() {
-		return r.r.Text(), nil
-	}
-	return "", io.EOF
+// Line returns the line on which the last record read began.
+func (r *csvReader) Line() int {
+	return r.recordLine
 }
 
-// check that the number of columns doesn't vary.
-func (r *csvReader) validateNumColumns(lenColumns int) error {
-	numColumns := uint(lenColumns)
-	if r.numColumns == 0 {
-		r.numColumns = numColumns
+func (r *csvReader) readRecord() ([]string, error) {
+	if err := r.skipBlankLines(); err != nil {
+		return nil, err
 	}
-	if r.numColumns != numColumns {
-		return ErrBadColumnLength
+	r.recordSize = 0
+	r.recordLine = r.line + 1
+	var columns []string
+	for {
+		column, end, err := r.readField()
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+		if end {
+			return columns, nil
+		}
 	}
-	return nil
 }
 
-// remove surrounding double-quotes from the string if there are any.
-// this will also un-escape any double-quote characters.
-func (r *csvReader) unquoteIfNeeded(str string) string {
-	if !isEnclosedInDoubleQuotes(str) {
-		return str
+func (r *csvReader) skipBlankLines() error {
+	for {
+		c, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		if c == '\r' && r.peekNewline() {
+			continue
+		}
+		if c != '\n' {
+			return r.unreadByte()
+		}
+	}
+}
+
+// readField reads the next field, and reports whether it was the last
+// field of the record.
+func (r *csvReader) readField() (string, bool, error) {
+	r.field.Reset()
+	c, err := r.readByte()
+	if err == io.EOF {
+		return "", true, nil
+	}
+	if err != nil {
+		return "", false, err
 	}
-	newStr, err := unquoteDoubleQuotes(strings.NewReader(str))
-	if err == nil {
-		return newStr
+	if c == '"' {
+		if err := r.readQuoted(); err != nil {
+			return "", false, err
+		}
+	} else if err := r.unreadByte(); err != nil {
+		return "", false, err
 	}
-	newStr, err = strconv.Unquote(str)
+	end, err := r.readUnquoted()
 	if err != nil {
-		return str
+		return "", false, err
 	}
-	return newStr
+	return r.field.String(), end, nil
 }
 
-func isEnclosedInDoubleQuotes(str string) bool {
-	r := strings.NewReader(str)
-	return isFirstCharDoubleQuote(r) && isLastCharDoubleQuote(r)
+// readQuoted reads the rest of a quoted field, up to and including its
+// closing quote.
+func (r *csvReader) readQuoted() error {
+	for {
+		c, err := r.readByte()
+		if err == io.EOF {
+			return ErrUnterminatedQuote
+		}
+		if err != nil {
+			return err
+		}
+		switch c {
+		case '"':
+			if !r.peekByte('"') {
+				return nil
+			}
+			r.field.WriteByte('"')
+		case '\\':
+			if r.escapedQuote() {
+				r.readByte()
+				r.field.WriteByte('"')
+				continue
+			}
+			r.field.WriteByte('\\')
+		default:
+			r.field.WriteByte(c)
+		}
+	}
 }
 
-func isFirstCharDoubleQuote(r *strings.Reader) bool {
-	fst, _, err := r.ReadRune()
-	return err == nil && fst == '"'
+// escapedQuote reports whether the next byte is a double quote that
+// a backslash escapes, rather than the quote closing the field, which
+// is followed by a delimiter, a newline or the end of the input.
+func (r *csvReader) escapedQuote() bool {
+	next, _ := r.r.Peek(1 + len(r.delimiter))
+	if len(next) == 0 || next[0] != '"' {
+		return false
+	}
+	after := next[1:]
+	switch {
+	case len(after) == 0, after[0] == '\n', after[0] == '\r', bytes.Equal(after, r.delimiter):
+		return false
+	}
+	return true
 }
 
-func isLastCharDoubleQuote(r *strings.Reader) bool {
-	if _, err := r.Seek(-1, io.SeekEnd); err != nil {
-		return false
+// readUnquoted reads up to the next delimiter or the end of the
+// record, and reports whether the end of the record was reached.
+func (r *csvReader) readUnquoted() (bool, error) {
+	for {
+		c, err := r.readByte()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		delimiter, err := r.readDelimiter(c)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case delimiter:
+			return false, nil
+		case c == '\n':
+			return true, nil
+		case c == '\r' && r.peekNewline():
+			return true, nil
+		default:
+			r.field.WriteByte(c)
+		}
+	}
+}
+
+// readDelimiter reports whether c begins the delimiter, consuming the
+// rest of the delimiter if it does.
+func (r *csvReader) readDelimiter(c byte) (bool, error) {
+	if c != r.delimiter[0] {
+		return false, nil
+	}
+	rest := r.delimiter[1:]
+	if next, err := r.r.Peek(len(rest)); err != nil || !bytes.Equal(next, rest) {
+		return false, nil
+	}
+	for range rest {
+		if _, err := r.readByte(); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// readByte reads the next byte, keeping track of the size of the
+// current record.
+func (r *csvReader) readByte() (byte, error) {
+	c, err := r.r.ReadByte()
+	if err != nil {
+		return c, err
 	}
-	lst, _, err := r.ReadRune()
-	return err == nil && lst == '"'
+	r.lastByte = c
+	r.recordSize++
+	if c == '\n' {
+		r.line++
+	}
+	if r.maxRecordSize > 0 && r.recordSize > r.maxRecordSize {
+		return c, ErrRecordTooLong
+	}
+	return c, nil
+}
+
+func (r *csvReader) unreadByte() error {
+	if err := r.r.UnreadByte(); err != nil {
+		return err
+	}
+	r.recordSize--
+	if r.lastByte == '\n' {
+		r.line--
+	}
+	return nil
 }
 
-// use encoding/csv to unquote double double-quotes because its good at that
-func unquoteDoubleQuotes(r *strings.Reader) (string, error) {
-	cr := csv.NewReader(r)
-	rec, err := cr.Read()
+// peekByte consumes the next byte if it is c, and reports whether it
+// was.
+func (r *csvReader) peekByte(c byte) bool {
+	next, err := r.readByte()
 	if err != nil {
-		return "", err
+		return false
 	}
-	return rec[0], nil
+	if next != c {
+		r.unreadByte()
+		return false
+	}
+	return true
+}
+
+func (r *csvReader) peekNewline() bool {
+	return r.peekByte('\n')
+}
+
+// check that the number of columns doesn't vary.
+func (r *csvReader) validateNumColumns(lenColumns int) error {
+	numColumns := uint(lenColumns)
+	if r.numColumns == 0 {
+		r.numColumns = numColumns
+	}
+	if r.numColumns != numColumns {
+		return ErrBadColumnLength
+	}
+	return nil
 }
@@ -1,9 +1,14 @@
-package main
+package uuidcrypt
 
 import (
 	"bytes"
+	stdcsv "encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestRead(t *testing.T) {
@@ -62,3 +67,111 @@ func TestReadMultilineWrongColumnLength(t *testing.T) {
 	data, err = csv.Read()
 	assert(t, err == ErrBadColumnLength, fmt.Sprintf("should encounter error: %v", ErrBadColumnLength))
 }
+
+func TestReadQuotedDelimiterAndNewline(t *testing.T) {
+	r := bytes.NewReader([]byte("foo,\"b,a\nr\",\"\"\"baz\"\"\"\r\nzip,\"za\\\\p\",zoop\n\n"))
+	csv := NewCSVReader(r, ',')
+	data, err := csv.Read()
+	assert(t, err == nil, fmt.Sprintf("should not encounter error: %v", err))
+	for i, el := range []string{"foo", "b,a\nr", `"baz"`} {
+		assert(t, data[i] == el, fmt.Sprintf("element %d should be '%s': '%s'", i, el, data[i]))
+	}
+	data, err = csv.Read()
+	assert(t, err == nil, fmt.Sprintf("should not encounter error: %v", err))
+	for i, el := range []string{"zip", `za\\p`, "zoop"} {
+		assert(t, data[i] == el, fmt.Sprintf("element %d should be '%s': '%s'", i, el, data[i]))
+	}
+	_, err = csv.Read()
+	assert(t, err == io.EOF, fmt.Sprintf("should encounter error: %v", io.EOF))
+}
+
+func TestReadBackslashes(t *testing.T) {
+	r := strings.NewReader("id,\"C:\\\"\nid2,\"a\\\\b\"\nid3,\"say \\\"hi\\\"\"\nid4,\"D:\\\"")
+	csv := NewCSVReader(r, ',')
+	for _, row := range [][]string{{"id", `C:\`}, {"id2", `a\\b`}, {"id3", `say "hi"`}, {"id4", `D:\`}} {
+		data, err := csv.Read()
+		assert(t, err == nil, fmt.Sprintf("should not encounter error: %v", err))
+		assert(t, len(data) == 2 && data[0] == row[0] && data[1] == row[1], fmt.Sprintf("should read %q: %q", row, data))
+	}
+	_, err := csv.Read()
+	assert(t, err == io.EOF, fmt.Sprintf("should encounter error: %v", io.EOF))
+}
+
+func TestReadEmptyFields(t *testing.T) {
+	r := bytes.NewReader([]byte("foo,,\n,\"\",baz"))
+	csv := NewCSVReader(r, ',')
+	for _, row := range [][]string{{"foo", "", ""}, {"", "", "baz"}} {
+		data, err := csv.Read()
+		assert(t, err == nil, fmt.Sprintf("should not encounter error: %v", err))
+		assert(t, len(data) == len(row), fmt.Sprintf("should read %d elements: %d", len(row), len(data)))
+		for i, el := range row {
+			assert(t, data[i] == el, fmt.Sprintf("element %d should be '%s': '%s'", i, el, data[i]))
+		}
+	}
+}
+
+func TestReadUnterminatedQuote(t *testing.T) {
+	r := bytes.NewReader([]byte("foo,\"bar"))
+	csv := NewCSVReader(r, ',')
+	_, err := csv.Read()
+	assert(t, err == ErrUnterminatedQuote, fmt.Sprintf("should encounter error: %v", ErrUnterminatedQuote))
+}
+
+func TestReadLongRecord(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
+	r := strings.NewReader("foo," + long + "\nbar,baz")
+	csv := NewCSVReader(r, ',')
+	data, err := csv.Read()
+	assert(t, err == nil, fmt.Sprintf("should not encounter error: %v", err))
+	assert(t, data[1] == long, "long element should be read in full")
+	data, err = csv.Read()
+	assert(t, err == nil, fmt.Sprintf("should not encounter error: %v", err))
+	assert(t, data[0] == "bar", fmt.Sprintf("element 0 should be 'bar': '%s'", data[0]))
+}
+
+func TestReadMaxRecordSize(t *testing.T) {
+	r := strings.NewReader("foo,bar\nfoo,barbaz")
+	csv := NewCSVReaderSize(r, ',', 8)
+	_, err := csv.Read()
+	assert(t, err == nil, fmt.Sprintf("should not encounter error: %v", err))
+	_, err = csv.Read()
+	assert(t, err == ErrRecordTooLong, fmt.Sprintf("should encounter error: %v", ErrRecordTooLong))
+}
+
+func TestReadSurfacesReaderError(t *testing.T) {
+	errRead := errors.New("read failed")
+	r := io.MultiReader(strings.NewReader("foo,bar\nfoo,"), iotest.ErrReader(errRead))
+	csv := NewCSVReader(r, ',')
+	_, err := csv.Read()
+	assert(t, err == nil, fmt.Sprintf("should not encounter error: %v", err))
+	_, err = csv.Read()
+	assert(t, err == errRead, fmt.Sprintf("should encounter error: %v", errRead))
+}
+
+func TestReadLine(t *testing.T) {
+	r := strings.NewReader("foo,bar\n\n\"b\naz\",qux\nzip,\"zap\"\n")
+	csv := NewCSVReader(r, ',')
+	for _, line := range []int{1, 3, 5} {
+		_, err := csv.Read()
+		assert(t, err == nil, fmt.Sprintf("should not encounter error: %v", err))
+		assert(t, csv.(LineTracker).Line() == line, fmt.Sprintf("record should begin on line %d: %d", line, csv.(LineTracker).Line()))
+	}
+}
+
+func TestReadInvalidUTF8(t *testing.T) {
+	data, err := NewCSVReader(strings.NewReader("a\xff,\"b\xfe\"\n"), ',').Read()
+	failIfError(t, err)
+	assert(t, data[0] == "a\xff" && data[1] == "b\xfe", fmt.Sprintf("invalid UTF-8 should be kept as is: %q", data))
+
+	var out bytes.Buffer
+	w := stdcsv.NewWriter(&out)
+	failIfError(t, w.Write(data))
+	w.Flush()
+	assert(t, out.String() == "a\xff,b\xfe\n", fmt.Sprintf("invalid UTF-8 should round-trip: %q", out.String()))
+}
+
+func TestReadMultibyteDelimiter(t *testing.T) {
+	data, err := NewCSVReader(strings.NewReader("foo\u00a7b\xc2r\u00a7\"b\u00a7z\""), '\u00a7').Read()
+	failIfError(t, err)
+	assert(t, len(data) == 3 && data[0] == "foo" && data[1] == "b\xc2r" && data[2] == "b\u00a7z", fmt.Sprintf("unexpected fields: %q", data))
+}
@@ -1,4 +1,4 @@
-package main
+package uuidcrypt
 
 import "crypto/cipher"
 
@@ -21,22 +21,44 @@ func NewECB(block cipher.Block) *ECB {
 
 // Encrypt encrypts a block-sized length plaintext into ciphertext.
 func (c *ECB) Encrypt(plaintext []byte) []byte {
-	bs := c.block.BlockSize()
-	if len(plaintext)%bs != 0 {
-		panic("invalid plaintext size")
-	}
 	ciphertext := make([]byte, len(plaintext))
-	c.block.Encrypt(ciphertext, plaintext)
+	c.EncryptBlocks(ciphertext, plaintext)
 	return ciphertext
 }
 
 // Decrypt decrypts a block-sized length ciphertext into plaintext.
 func (c *ECB) Decrypt(ciphertext []byte) []byte {
+	plaintext := make([]byte, len(ciphertext))
+	c.DecryptBlocks(plaintext, ciphertext)
+	return plaintext
+}
+
+// EncryptBlocks encrypts each block of plaintext into ciphertext,
+// which must be at least as long. They may be the same slice.
+func (c *ECB) EncryptBlocks(ciphertext, plaintext []byte) {
+	bs := c.block.BlockSize()
+	if len(plaintext)%bs != 0 {
+		panic("invalid plaintext size")
+	}
+	if len(ciphertext) < len(plaintext) {
+		panic("output smaller than input")
+	}
+	for i := 0; i < len(plaintext); i += bs {
+		c.block.Encrypt(ciphertext[i:i+bs], plaintext[i:i+bs])
+	}
+}
+
+// DecryptBlocks decrypts each block of ciphertext into plaintext,
+// which must be at least as long. They may be the same slice.
+func (c *ECB) DecryptBlocks(plaintext, ciphertext []byte) {
 	bs := c.block.BlockSize()
 	if len(ciphertext)%bs != 0 {
 		panic("invalid ciphertext size")
 	}
-	plaintext := make([]byte, len(ciphertext))
-	c.block.Decrypt(plaintext, ciphertext)
-	return plaintext
+	if len(plaintext) < len(ciphertext) {
+		panic("output smaller than input")
+	}
+	for i := 0; i < len(ciphertext); i += bs {
+		c.block.Decrypt(plaintext[i:i+bs], ciphertext[i:i+bs])
+	}
 }
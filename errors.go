@@ -0,0 +1,85 @@
+package uuidcrypt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorKind classifies the failures reported by uuidcrypt.
+type ErrorKind int
+
+const (
+	// ConfigError is an invalid configuration or invalid options.
+	ConfigError ErrorKind = 1 + iota
+
+	// IOError is a failure to open, read, write or rename a file.
+	IOError
+
+	// ParseError is a malformed CSV record or a value that is not a
+	// UUID.
+	ParseError
+
+	// CryptoError is a failure to derive a key or to encrypt or
+	// decrypt a value.
+	CryptoError
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ConfigError:
+		return "config error"
+	case IOError:
+		return "i/o error"
+	case ParseError:
+		return "parse error"
+	case CryptoError:
+		return "crypto error"
+	}
+	return "error"
+}
+
+// Error is an error of a known kind. Where known, it records the file
+// and the 1-based line and column at which it occurred.
+type Error struct {
+	Kind   ErrorKind
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *Error) Error() string {
+	msg := e.Err.Error()
+	if e.Column > 0 {
+		msg = fmt.Sprintf("column %d: %s", e.Column, msg)
+	}
+	if e.Line > 0 {
+		msg = fmt.Sprintf("line %d: %s", e.Line, msg)
+	}
+	if e.File != "" {
+		msg = fmt.Sprintf("%s: %s", e.File, msg)
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of err, or zero if err is not an *Error.
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return 0
+}
+
+// withKind wraps err as an *Error of the given kind, unless it already
+// is one.
+func withKind(kind ErrorKind, err error) error {
+	if err == nil || KindOf(err) != 0 {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
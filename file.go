@@ -1,14 +1,14 @@
-package main
+package uuidcrypt
 
 import (
 	"bufio"
 	"encoding/csv"
 	"fmt"
 	"io"
-	"os"
 )
 
-const stdPipe = "-"
+// StdPipe is the file name that refers to stdin or stdout.
+const StdPipe = "-"
 
 type File interface {
 	Read() ([]string, error)
@@ -16,6 +16,12 @@ type File interface {
 	Close() error
 }
 
+// LineTracker is implemented by Files that can report the line on
+// which the last record they read began.
+type LineTracker interface {
+	Line() int
+}
+
 type CSVOptions func(*csvFile)
 
 func WithDelimiter(delimiter string) CSVOptions {
@@ -28,12 +34,31 @@ func WithDelimiter(delimiter string) CSVOptions {
 	}
 }
 
+// WithMaxRecordSize limits the size of records read from the CSV to
+// maxRecordSize bytes. Zero, the default, means records may be of any
+// size.
+func WithMaxRecordSize(maxRecordSize int) CSVOptions {
+	return func(f *csvFile) {
+		f.maxRecordSize = maxRecordSize
+	}
+}
+
+// WithCompression specifies how the file is compressed when it is
+// written. AutoCompression, the default, compresses it by its name.
+// Files are always decompressed by their contents when read.
+func WithCompression(compression Compression) CSVOptions {
+	return func(f *csvFile) {
+		f.compression = compression
+	}
+}
+
 const defaultDelimiter = ','
 
 func NewCSVFile(filename string, options ...CSVOptions) File {
 	f := &csvFile{
-		filename:  filename,
-		delimiter: defaultDelimiter,
+		filename:    filename,
+		delimiter:   defaultDelimiter,
+		compression: AutoCompression,
 	}
 	for _, opt := range options {
 		opt(f)
@@ -42,14 +67,16 @@ func NewCSVFile(filename string, options ...CSVOptions) File {
 }
 
 type csvFile struct {
-	r         io.ReadCloser
-	w         io.WriteCloser
-	bw        *bufio.Writer
-	reader    CSVReader
-	writer    *csv.Writer
-	filename  string
-	delimiter rune
-	numLines  uint
+	r             io.ReadCloser
+	w             io.WriteCloser
+	bw            *bufio.Writer
+	reader        CSVReader
+	writer        *csv.Writer
+	filename      string
+	delimiter     rune
+	maxRecordSize int
+	compression   Compression
+	numLines      uint
 }
 
 func (f *csvFile) Read() ([]string, error) {
@@ -63,26 +90,32 @@ func (f *csvFile) Read() ([]string, error) {
 	return row, err
 }
 
+// Name returns the name of the file.
+func (f *csvFile) Name() string {
+	return f.filename
+}
+
+// Line returns the line on which the last record read began.
+func (f *csvFile) Line() int {
+	if l, ok := f.reader.(LineTracker); ok {
+		return l.Line()
+	}
+	return int(f.numLines)
+}
+
 func (f *csvFile) createReader() error {
 	if f.writer != nil {
 		return fmt.Errorf("file object is already a writer")
 	}
-	file, err := f.openFileOrStdin(f.filename)
+	file, err := OpenFile(f.filename)
 	if err != nil {
 		return err
 	}
-	f.reader = NewCSVReader(file, f.delimiter)
+	f.reader = NewCSVReaderSize(file, f.delimiter, f.maxRecordSize)
 	f.r = file
 	return nil
 }
 
-func (f *csvFile) openFileOrStdin(filename string) (io.ReadCloser, error) {
-	if filename == stdPipe {
-		return os.Stdin, nil
-	}
-	return os.Open(filename)
-}
-
 func (f *csvFile) Write(row []string) error {
 	if f.writer == nil {
 		if err := f.createWriter(); err != nil {
@@ -96,7 +129,7 @@ func (f *csvFile) createWriter() error {
 	if f.reader != nil {
 		return fmt.Errorf("file object is already a reader")
 	}
-	file, err := createFileOrStdout(f.filename)
+	file, err := CreateCompressedFile(f.filename, f.compression)
 	if err != nil {
 		return fmt.Errorf("file create error: %v", err)
 	}
@@ -106,16 +139,13 @@ func (f *csvFile) createWriter() error {
 	return nil
 }
 
-func createFileOrStdout(filename string) (io.WriteCloser, error) {
-	if filename == stdPipe {
-		return os.Stdout, nil
-	}
-	return os.Create(filename)
-}
-
 func (f *csvFile) Close() error {
 	if f.writer != nil {
 		f.writer.Flush()
+		if err := f.writer.Error(); err != nil {
+			f.w.Close()
+			return err
+		}
 	}
 	if f.w != nil {
 		return f.w.Close()
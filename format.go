@@ -0,0 +1,88 @@
+package uuidcrypt
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownUUIDFormat = errors.New("format: unknown uuid format")
+)
+
+// UUIDFormat decides how processed UUIDs are written out.
+type UUIDFormat int
+
+const (
+	// PreserveFormat writes each UUID in the representation it was
+	// read in: uppercase or lowercase, with or without hyphens, and
+	// with `{braces}` or a `urn:uuid:` prefix. UUIDs in mixed case are
+	// written in lowercase.
+	PreserveFormat UUIDFormat = 1 + iota
+
+	// CanonicalFormat writes every UUID in lowercase hyphenated form.
+	CanonicalFormat
+)
+
+// ParseUUIDFormat returns the UUIDFormat named by str, either
+// "preserve" or "canonical". An empty string means PreserveFormat.
+func ParseUUIDFormat(str string) (UUIDFormat, error) {
+	switch str {
+	case "", "preserve":
+		return PreserveFormat, nil
+	case "canonical":
+		return CanonicalFormat, nil
+	}
+	return 0, ErrUnknownUUIDFormat
+}
+
+// Format returns u in the format f. With PreserveFormat, u is written
+// in the representation of original, a UUID in any form accepted by
+// uuid.Parse.
+func (f UUIDFormat) Format(u uuid.UUID, original string) string {
+	var buf [maxUUIDLength]byte
+	return string(f.appendFormat(buf[:0], u[:], original))
+}
+
+// maxUUIDLength is the length of the longest representation of a
+// UUID, with a `urn:uuid:` prefix.
+const maxUUIDLength = 36 + 9
+
+// appendFormat appends the 16-byte UUID b to dst in the format f.
+func (f UUIDFormat) appendFormat(dst, b []byte, original string) []byte {
+	if f == CanonicalFormat {
+		return appendUUID(dst, b, true, false)
+	}
+	return detectUUIDLayout(original).appendFormat(dst, b)
+}
+
+// uuidLayout is the textual representation of a UUID.
+type uuidLayout struct {
+	prefix  string
+	suffix  string
+	hyphens bool
+	upper   bool
+}
+
+// detectUUIDLayout returns the layout of s, a UUID in any form accepted
+// by uuid.Parse.
+func detectUUIDLayout(s string) uuidLayout {
+	l := uuidLayout{hyphens: true}
+	switch len(s) {
+	case 36 + 9:
+		l.prefix, s = s[:9], s[9:]
+	case 36 + 2:
+		l.prefix, l.suffix, s = s[:1], s[37:], s[1:37]
+	case 32:
+		l.hyphens = false
+	}
+	l.upper = strings.ContainsAny(s, "ABCDEF") && !strings.ContainsAny(s, "abcdef")
+	return l
+}
+
+func (l uuidLayout) appendFormat(dst, b []byte) []byte {
+	dst = append(dst, l.prefix...)
+	dst = appendUUID(dst, b, l.hyphens, l.upper)
+	return append(dst, l.suffix...)
+}
@@ -0,0 +1,55 @@
+package uuidcrypt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUUIDFormat(t *testing.T) {
+	u := uuid.MustParse(testUUID2)
+	upper := strings.ToUpper(testUUID)
+	hyphenless := strings.ReplaceAll(testUUID, "-", "")
+	for _, tt := range []struct {
+		original, expected string
+	}{
+		{testUUID, testUUID2},
+		{upper, strings.ToUpper(testUUID2)},
+		{hyphenless, strings.ReplaceAll(testUUID2, "-", "")},
+		{strings.ToUpper(hyphenless), strings.ToUpper(strings.ReplaceAll(testUUID2, "-", ""))},
+		{"{" + testUUID + "}", "{" + testUUID2 + "}"},
+		{"{" + upper + "}", "{" + strings.ToUpper(testUUID2) + "}"},
+		{"urn:uuid:" + testUUID, "urn:uuid:" + testUUID2},
+		{"URN:UUID:" + upper, "URN:UUID:" + strings.ToUpper(testUUID2)},
+		{"4A1981ca-94af-481d-8266-58d86cc8199a", testUUID2},
+	} {
+		actual := PreserveFormat.Format(u, tt.original)
+		assert(t, actual == tt.expected, "expected "+tt.expected+" for "+tt.original+": "+actual)
+		assert(t, CanonicalFormat.Format(u, tt.original) == testUUID2, "canonical format should be lowercase hyphenated")
+	}
+
+	_, err := ParseUUIDFormat("upper")
+	assert(t, errors.Is(err, ErrUnknownUUIDFormat), "expected unknown uuid format error")
+}
+
+func TestPreserveFormatRoundTrip(t *testing.T) {
+	input := [][]string{
+		{strings.ToUpper(testUUID)},
+		{strings.ReplaceAll(testUUID, "-", "")},
+		{"{" + testUUID + "}"},
+		{"urn:uuid:" + testUUID},
+	}
+	output := runUUIDCrypt(t, input, newTestProcessor(testNamespace, EncryptType))
+	decrypted := runUUIDCrypt(t, output, newTestProcessor(testNamespace, DecryptType))
+	for i := range input {
+		assert(t, len(output[i][0]) == len(input[i][0]), "encrypted uuid should keep its format: "+output[i][0])
+		assert(t, decrypted[i][0] == input[i][0], "decrypted uuid should match input: "+decrypted[i][0])
+	}
+
+	canonical := runUUIDCrypt(t, input, newTestProcessor(testNamespace, EncryptType), WithUUIDFormat(CanonicalFormat))
+	for _, row := range canonical {
+		assert(t, row[0] == canonical[0][0], "canonical format should be the same for every input format: "+row[0])
+	}
+}
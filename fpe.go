@@ -0,0 +1,128 @@
+package uuidcrypt
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+)
+
+const (
+	feistelRounds = 10
+	halfBits      = 61
+	halfMask      = 1<<halfBits - 1
+)
+
+// UUIDFeistel performs format-preserving encryption of UUIDs. Only
+// the 122 bits that are not fixed by the UUID's version and variant
+// are encrypted, so that an encrypted version 4 UUID is still a valid
+// version 4 UUID.
+//
+// The 122 bits are split into two 61-bit halves and run through a
+// balanced Feistel network whose round function is the underlying
+// block cipher.
+type UUIDFeistel struct {
+	block cipher.Block
+}
+
+// NewUUIDFeistel returns a new UUIDFeistel object using the provided
+// cipher block.
+func NewUUIDFeistel(block cipher.Block) *UUIDFeistel {
+	return &UUIDFeistel{
+		block: block,
+	}
+}
+
+// Encrypt encrypts a 16-byte UUID, preserving its version and
+// variant bits.
+func (c *UUIDFeistel) Encrypt(plaintext []byte) []byte {
+	if len(plaintext) != 16 {
+		panic("invalid plaintext size")
+	}
+	ciphertext := make([]byte, 16)
+	c.EncryptBlocks(ciphertext, plaintext)
+	return ciphertext
+}
+
+// Decrypt decrypts a 16-byte UUID produced by Encrypt.
+func (c *UUIDFeistel) Decrypt(ciphertext []byte) []byte {
+	if len(ciphertext) != 16 {
+		panic("invalid ciphertext size")
+	}
+	plaintext := make([]byte, 16)
+	c.DecryptBlocks(plaintext, ciphertext)
+	return plaintext
+}
+
+// EncryptBlocks encrypts each 16-byte UUID of plaintext into
+// ciphertext, which must be at least as long. They may be the same
+// slice.
+func (c *UUIDFeistel) EncryptBlocks(ciphertext, plaintext []byte) {
+	if len(plaintext)%16 != 0 {
+		panic("invalid plaintext size")
+	}
+	for i := 0; i < len(plaintext); i += 16 {
+		left, right, fixed := splitUUIDBits(plaintext[i : i+16])
+		for r := 0; r < feistelRounds; r++ {
+			left, right = right, left^c.round(r, right)
+		}
+		joinUUIDBits(ciphertext[i:i+16], left, right, fixed)
+	}
+}
+
+// DecryptBlocks decrypts each 16-byte UUID of ciphertext into
+// plaintext, which must be at least as long. They may be the same
+// slice.
+func (c *UUIDFeistel) DecryptBlocks(plaintext, ciphertext []byte) {
+	if len(ciphertext)%16 != 0 {
+		panic("invalid ciphertext size")
+	}
+	for i := 0; i < len(ciphertext); i += 16 {
+		left, right, fixed := splitUUIDBits(ciphertext[i : i+16])
+		for r := feistelRounds - 1; r >= 0; r-- {
+			left, right = right^c.round(r, left), left
+		}
+		joinUUIDBits(plaintext[i:i+16], left, right, fixed)
+	}
+}
+
+// round is the Feistel round function: the block cipher applied to
+// the round number and one half, truncated to 61 bits.
+func (c *UUIDFeistel) round(i int, half uint64) uint64 {
+	var in, out [16]byte
+	in[0] = 'F'
+	in[1] = byte(i)
+	binary.BigEndian.PutUint64(in[8:], half)
+	c.block.Encrypt(out[:], in[:])
+	return binary.BigEndian.Uint64(out[:8]) & halfMask
+}
+
+// fixedBits are the version (4 bits) and variant (2 bits) of a UUID.
+type fixedBits struct {
+	version uint64
+	variant uint64
+}
+
+// splitUUIDBits removes the version and variant bits from a UUID and
+// splits the remaining 122 bits into two 61-bit halves.
+func splitUUIDBits(b []byte) (uint64, uint64, fixedBits) {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	fixed := fixedBits{
+		version: hi >> 12 & 0xf,
+		variant: lo >> 62,
+	}
+	hi60 := hi>>16<<12 | hi&0xfff
+	lo62 := lo & (1<<62 - 1)
+	left := hi60<<1 | lo62>>halfBits
+	right := lo62 & halfMask
+	return left, right, fixed
+}
+
+// joinUUIDBits is the inverse of splitUUIDBits, writing the UUID to b.
+func joinUUIDBits(b []byte, left, right uint64, fixed fixedBits) {
+	hi60 := left >> 1
+	lo62 := (left&1)<<halfBits | right
+	hi := hi60>>12<<16 | fixed.version<<12 | hi60&0xfff
+	lo := fixed.variant<<62 | lo62
+	binary.BigEndian.PutUint64(b[:8], hi)
+	binary.BigEndian.PutUint64(b[8:], lo)
+}
@@ -0,0 +1,56 @@
+package uuidcrypt
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestValidUUIDsPreserveVersionAndVariant(t *testing.T) {
+	enc := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType, WithValidUUIDs())
+	dec := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), DecryptType, WithValidUUIDs())
+	for i := 0; i < 100; i++ {
+		for _, in := range []uuid.UUID{uuid.New(), uuid.NewSHA1(uuid.NameSpaceDNS, []byte{byte(i)})} {
+			ciphertext := enc.Process(in[:])
+			out, err := uuid.FromBytes(ciphertext)
+			failIfError(t, err)
+			assert(t, out != in, "ciphertext should not match plaintext")
+			assert(t, out.Version() == in.Version(), fmt.Sprintf("version should be preserved: %s -> %s", in, out))
+			assert(t, out.Variant() == uuid.RFC4122, fmt.Sprintf("variant should be preserved: %s -> %s", in, out))
+			assert(t, bytes.Equal(dec.Process(ciphertext), in[:]), "decrypted uuid should match plaintext")
+		}
+	}
+}
+
+func TestSplitJoinUUIDBits(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		in := uuid.New()
+		left, right, fixed := splitUUIDBits(in[:])
+		assert(t, left <= halfMask && right <= halfMask, "halves should be 61 bits")
+		var out [16]byte
+		joinUUIDBits(out[:], left, right, fixed)
+		assert(t, bytes.Equal(out[:], in[:]), "join should reverse split")
+	}
+}
+
+// TestValidUUIDsKnownAnswer pins the ciphertext of WithValidUUIDs, so
+// that changes to the key derivation or round layout cannot silently
+// break existing data.
+func TestValidUUIDsKnownAnswer(t *testing.T) {
+	in := uuid.MustParse(testUUID)
+	for _, tt := range []struct {
+		options  []ProcessorOptions
+		expected string
+	}{
+		{[]ProcessorOptions{WithValidUUIDs()}, "942773f7-468c-4754-9831-220a18d94148"},
+		{[]ProcessorOptions{WithValidUUIDs(), WithKDF(KDFv2), WithKeySize(256)}, "e293b3ef-5006-4f75-bd61-3ac5501dbcdf"},
+	} {
+		enc := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType, tt.options...)
+		out := ProcessUUID(enc, in)
+		assert(t, out.String() == tt.expected, fmt.Sprintf("unexpected ciphertext: %s", out))
+		dec := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), DecryptType, tt.options...)
+		assert(t, ProcessUUID(dec, out) == in, "decrypted uuid should match plaintext")
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/APTy/uuidcrypt
+
+go 1.24.0
+
+require (
+	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.18.0
+	golang.org/x/crypto v0.45.0
+	golang.org/x/term v0.37.0
+)
+
+require golang.org/x/sys v0.38.0 // indirect
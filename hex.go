@@ -0,0 +1,75 @@
+package uuidcrypt
+
+import "github.com/google/uuid"
+
+const (
+	lowerHex = "0123456789abcdef"
+	upperHex = "0123456789ABCDEF"
+)
+
+// canonicalOffsets are the offsets of the 16 hex-encoded bytes of a
+// UUID in its canonical 36-char form.
+var canonicalOffsets = [uuidSize]int{0, 2, 4, 6, 9, 11, 14, 16, 19, 21, 24, 26, 28, 30, 32, 34}
+
+// parseUUID decodes s, a UUID in any form accepted by uuid.Parse, into
+// dst. UUIDs in the canonical 36-char form are decoded without
+// allocating.
+func parseUUID(dst []byte, s string) error {
+	if parseCanonicalUUID(dst, s) {
+		return nil
+	}
+	u, err := uuid.Parse(s)
+	if err != nil {
+		return err
+	}
+	copy(dst, u[:])
+	return nil
+}
+
+// parseCanonicalUUID decodes s into dst, and reports whether s was a
+// UUID in the canonical 36-char form.
+func parseCanonicalUUID(dst []byte, s string) bool {
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return false
+	}
+	for i, offset := range canonicalOffsets {
+		hi, ok := fromHexChar(s[offset])
+		if !ok {
+			return false
+		}
+		lo, ok := fromHexChar(s[offset+1])
+		if !ok {
+			return false
+		}
+		dst[i] = hi<<4 | lo
+	}
+	return true
+}
+
+func fromHexChar(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// appendUUID appends the 16-byte UUID b to dst in hex, with or without
+// hyphens, and in lowercase or uppercase.
+func appendUUID(dst, b []byte, hyphens, upper bool) []byte {
+	digits := lowerHex
+	if upper {
+		digits = upperHex
+	}
+	for i, c := range b {
+		if hyphens && (i == 4 || i == 6 || i == 8 || i == 10) {
+			dst = append(dst, '-')
+		}
+		dst = append(dst, digits[c>>4], digits[c&0xf])
+	}
+	return dst
+}
@@ -0,0 +1,100 @@
+package uuidcrypt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseUUID(t *testing.T) {
+	for _, s := range []string{
+		testUUID,
+		strings.ToUpper(testUUID2),
+		strings.ReplaceAll(testUUID, "-", ""),
+		"{" + testUUID + "}",
+		"urn:uuid:" + testUUID,
+	} {
+		var b [16]byte
+		failIfError(t, parseUUID(b[:], s))
+		expected := uuid.MustParse(s)
+		assert(t, bytes.Equal(b[:], expected[:]), "parsed uuid should match uuid.Parse: "+s)
+	}
+	for _, s := range []string{"", "NULL", "4a1981ca-94af-481d-8266-58d86cc8199g", "4a1981ca_94af-481d-8266-58d86cc8199a"} {
+		var b [16]byte
+		assert(t, parseUUID(b[:], s) != nil, "invalid uuid should not parse: "+s)
+	}
+}
+
+func TestAppendUUID(t *testing.T) {
+	u := uuid.MustParse(testUUID)
+	assert(t, string(appendUUID(nil, u[:], true, false)) == testUUID, "should format as lowercase hyphenated")
+	assert(t, string(appendUUID(nil, u[:], false, true)) == strings.ToUpper(strings.ReplaceAll(testUUID, "-", "")), "should format as uppercase hyphenless")
+}
+
+func TestUUIDHexDoesNotAllocate(t *testing.T) {
+	var b [16]byte
+	var buf [maxUUIDLength]byte
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := parseUUID(b[:], testUUID); err != nil {
+			t.Fatal(err)
+		}
+		PreserveFormat.appendFormat(buf[:0], b[:], testUUID)
+	})
+	assert(t, allocs == 0, "parsing and formatting a canonical uuid should not allocate")
+}
+
+func BenchmarkParseUUID(b *testing.B) {
+	var dst [16]byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := parseUUID(dst[:], testUUID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFormatUUID(b *testing.B) {
+	u := uuid.MustParse(testUUID)
+	var buf [maxUUIDLength]byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		PreserveFormat.appendFormat(buf[:0], u[:], testUUID)
+	}
+}
+
+func batchRecords(n int) [][]string {
+	records := make([][]string, n)
+	for i := range records {
+		records[i] = []string{testUUID, "data"}
+	}
+	return records
+}
+
+func TestProcessRecordsAllocs(t *testing.T) {
+	processor := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType)
+	u := NewUUIDCrypt(&memFile{}, &memFile{}, processor).(*uuidCrypt)
+	records := batchRecords(batchSize)
+	cells := u.processRecords(records)
+	expected, err := processUUIDString(processor, testUUID, PreserveFormat)
+	failIfError(t, err)
+	for i, row := range cells {
+		assert(t, len(row) == 1 && row[0].err == nil && row[0].value == expected, fmt.Sprintf("row %d should be processed: %v", i, row))
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		u.processRecords(records)
+	})
+	assert(t, allocs <= 8, fmt.Sprintf("allocations should not grow with the batch: %v", allocs))
+}
+
+func BenchmarkProcessRecords(b *testing.B) {
+	processor := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType)
+	u := NewUUIDCrypt(&memFile{}, &memFile{}, processor).(*uuidCrypt)
+	records := batchRecords(batchSize)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		u.processRecords(records)
+	}
+}
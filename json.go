@@ -0,0 +1,447 @@
+package uuidcrypt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidJSON     = errors.New("json: invalid document")
+	ErrInvalidJSONPath = errors.New("json: invalid field path")
+)
+
+// jsonPathElem is one step of the path to a JSON value: an object key,
+// or an array index if key is empty and index is not negative.
+type jsonPathElem struct {
+	key   string
+	index int
+}
+
+// jsonSelector decides which JSON string values are transformed.
+type jsonSelector interface {
+	match(path []jsonPathElem) bool
+}
+
+// fieldPath is a jsonSelector for dotted field paths such as
+// `user.id` or `events[].user_id`, where `[]` matches every element
+// of an array.
+type fieldPath []jsonPathElem
+
+// parseFieldPath parses a dotted field path. Array wildcards are
+// represented by an index of anyIndex.
+func parseFieldPath(path string) (fieldPath, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidJSONPath, path)
+	}
+	var fp fieldPath
+	for _, segment := range strings.Split(path, ".") {
+		key := strings.TrimRight(segment, "[]")
+		brackets := segment[len(key):]
+		if key == "" && brackets == "" || len(brackets)%2 != 0 || strings.Contains(key, "[") || strings.Contains(key, "]") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidJSONPath, path)
+		}
+		if key != "" {
+			fp = append(fp, jsonPathElem{key: key, index: -1})
+		}
+		for i := 0; i < len(brackets); i += 2 {
+			if brackets[i:i+2] != "[]" {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidJSONPath, path)
+			}
+			fp = append(fp, jsonPathElem{index: anyIndex})
+		}
+	}
+	return fp, nil
+}
+
+const anyIndex = -2
+
+func (fp fieldPath) match(path []jsonPathElem) bool {
+	if len(path) != len(fp) {
+		return false
+	}
+	for i, elem := range fp {
+		if elem.index == anyIndex {
+			if path[i].key != "" || path[i].index < 0 {
+				return false
+			}
+		} else if elem.key != path[i].key {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonWriter is satisfied by both *bufio.Writer and *bytes.Buffer.
+type jsonWriter interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
+// discardJSON is a jsonWriter that discards everything written to it.
+type discardJSON struct{}
+
+func (discardJSON) Write(b []byte) (int, error)       { return len(b), nil }
+func (discardJSON) WriteByte(byte) error              { return nil }
+func (discardJSON) WriteString(s string) (int, error) { return len(s), nil }
+
+// jsonRewriter copies a JSON document from r to w byte for byte,
+// except for string values that transform replaces. It never holds
+// more than a single string value in memory, so it can be used on
+// documents of any size.
+type jsonRewriter struct {
+	r         io.ByteScanner
+	w         jsonWriter
+	path      []jsonPathElem
+	offset    int
+	line      int
+	last      byte
+	raw       []byte
+	transform func(path []jsonPathElem, value string) (string, bool, error)
+	// nonString is called for every value that is not a string, and
+	// reports whether to replace the value with an empty string.
+	nonString func(path []jsonPathElem) (bool, error)
+}
+
+// rewrite copies a single JSON value, along with any surrounding
+// whitespace. It returns io.EOF if there is no value left to copy.
+func (j *jsonRewriter) rewrite() error {
+	c, err := j.skipSpace()
+	if err != nil {
+		return err
+	}
+	if err := j.value(c); err != nil {
+		return j.unexpectedEOF(err)
+	}
+	if _, err := j.skipSpace(); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func (j *jsonRewriter) readByte() (byte, error) {
+	c, err := j.r.ReadByte()
+	if err != nil {
+		return c, err
+	}
+	j.offset++
+	if c == '\n' {
+		j.line++
+	}
+	j.last = c
+	return c, nil
+}
+
+func (j *jsonRewriter) unreadByte() error {
+	if err := j.r.UnreadByte(); err != nil {
+		return err
+	}
+	j.offset--
+	if j.last == '\n' {
+		j.line--
+	}
+	return nil
+}
+
+// skipSpace copies whitespace, and returns the next byte without
+// consuming it.
+func (j *jsonRewriter) skipSpace() (byte, error) {
+	for {
+		c, err := j.readByte()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			if err := j.w.WriteByte(c); err != nil {
+				return 0, err
+			}
+		default:
+			return c, j.unreadByte()
+		}
+	}
+}
+
+// value copies any JSON value, replacing it if it is a string that
+// transform replaces, or a value that nonString blanks.
+func (j *jsonRewriter) value(c byte) error {
+	if c != '"' && j.nonString != nil {
+		blank, err := j.nonString(j.path)
+		if err != nil {
+			return err
+		}
+		if blank {
+			return j.blank(c)
+		}
+	}
+	return j.copyValue(c)
+}
+
+// blank reads a value without copying it, and writes an empty string
+// in its place.
+func (j *jsonRewriter) blank(c byte) error {
+	w := j.w
+	j.w = discardJSON{}
+	err := j.copyValue(c)
+	j.w = w
+	if err != nil {
+		return err
+	}
+	_, err = j.w.WriteString(`""`)
+	return err
+}
+
+func (j *jsonRewriter) copyValue(c byte) error {
+	switch {
+	case c == '{':
+		return j.object()
+	case c == '[':
+		return j.array()
+	case c == '"':
+		return j.string()
+	case c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z':
+		return j.literal()
+	}
+	return j.invalid(c)
+}
+
+func (j *jsonRewriter) object() error {
+	if err := j.copyByte('{'); err != nil {
+		return err
+	}
+	c, err := j.skipSpace()
+	if err != nil {
+		return err
+	}
+	if c == '}' {
+		return j.copyByte('}')
+	}
+	for {
+		if c != '"' {
+			return j.invalid(c)
+		}
+		raw, err := j.readString()
+		if err != nil {
+			return err
+		}
+		key, err := decodeJSONString(raw)
+		if err != nil {
+			return err
+		}
+		if _, err := j.w.Write(raw); err != nil {
+			return err
+		}
+		if c, err = j.skipSpace(); err != nil {
+			return err
+		}
+		if err := j.copyByte(':'); err != nil {
+			return err
+		}
+		if c, err = j.skipSpace(); err != nil {
+			return err
+		}
+		j.path = append(j.path, jsonPathElem{key: key, index: -1})
+		if err := j.value(c); err != nil {
+			return err
+		}
+		j.path = j.path[:len(j.path)-1]
+		if c, err = j.skipSpace(); err != nil {
+			return err
+		}
+		if c == '}' {
+			return j.copyByte('}')
+		}
+		if err := j.copyByte(','); err != nil {
+			return err
+		}
+		if c, err = j.skipSpace(); err != nil {
+			return err
+		}
+	}
+}
+
+func (j *jsonRewriter) array() error {
+	if err := j.copyByte('['); err != nil {
+		return err
+	}
+	c, err := j.skipSpace()
+	if err != nil {
+		return err
+	}
+	if c == ']' {
+		return j.copyByte(']')
+	}
+	for i := 0; ; i++ {
+		j.path = append(j.path, jsonPathElem{index: i})
+		if err := j.value(c); err != nil {
+			return err
+		}
+		j.path = j.path[:len(j.path)-1]
+		if c, err = j.skipSpace(); err != nil {
+			return err
+		}
+		if c == ']' {
+			return j.copyByte(']')
+		}
+		if err := j.copyByte(','); err != nil {
+			return err
+		}
+		if c, err = j.skipSpace(); err != nil {
+			return err
+		}
+	}
+}
+
+// string copies a string value, replacing it if transform does.
+func (j *jsonRewriter) string() error {
+	raw, err := j.readString()
+	if err != nil {
+		return err
+	}
+	value, err := decodeJSONString(raw)
+	if err != nil {
+		return err
+	}
+	newValue, ok, err := j.transform(j.path, value)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		_, err := j.w.Write(raw)
+		return err
+	}
+	encoded, err := json.Marshal(newValue)
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(encoded)
+	return err
+}
+
+// readString reads a quoted string, returning it as is.
+func (j *jsonRewriter) readString() ([]byte, error) {
+	j.raw = j.raw[:0]
+	c, err := j.readByte()
+	if err != nil {
+		return nil, err
+	}
+	j.raw = append(j.raw, c)
+	escaped := false
+	for {
+		c, err := j.readByte()
+		if err != nil {
+			return nil, err
+		}
+		j.raw = append(j.raw, c)
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			return j.raw, nil
+		}
+	}
+}
+
+// literal copies a number, true, false or null.
+func (j *jsonRewriter) literal() error {
+	start := j.offset + 1
+	j.raw = j.raw[:0]
+	for {
+		c, err := j.readByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if isLiteralEnd(c) {
+			if err := j.unreadByte(); err != nil {
+				return err
+			}
+			break
+		}
+		j.raw = append(j.raw, c)
+	}
+	if !validLiteral(j.raw) {
+		return fmt.Errorf("%w: invalid literal %q at offset %d", ErrInvalidJSON, j.raw, start)
+	}
+	_, err := j.w.Write(j.raw)
+	return err
+}
+
+// isLiteralEnd reports whether c may follow a literal.
+func isLiteralEnd(c byte) bool {
+	switch c {
+	case ',', '}', ']', ' ', '\t', '\r', '\n':
+		return true
+	}
+	return false
+}
+
+// numberPattern matches a JSON number.
+var numberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// validLiteral reports whether b is a JSON number, true, false or null.
+func validLiteral(b []byte) bool {
+	switch string(b) {
+	case "true", "false", "null":
+		return true
+	}
+	return numberPattern.Match(b)
+}
+
+func (j *jsonRewriter) copyByte(expected byte) error {
+	c, err := j.readByte()
+	if err != nil {
+		return err
+	}
+	if c != expected {
+		return j.invalid(c)
+	}
+	return j.w.WriteByte(c)
+}
+
+func (j *jsonRewriter) invalid(c byte) error {
+	return fmt.Errorf("%w: unexpected %q at offset %d", ErrInvalidJSON, c, j.offset)
+}
+
+func (j *jsonRewriter) unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return fmt.Errorf("%w: unexpected end of input at offset %d", ErrInvalidJSON, j.offset)
+	}
+	return err
+}
+
+func decodeJSONString(raw []byte) (string, error) {
+	if !strings.ContainsRune(string(raw), '\\') {
+		return string(raw[1 : len(raw)-1]), nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+	return s, nil
+}
+
+// formatJSONPath formats a path for error messages, e.g. `events[2].id`.
+func formatJSONPath(path []jsonPathElem) string {
+	var b strings.Builder
+	for _, elem := range path {
+		if elem.index >= 0 {
+			b.WriteString("[" + strconv.Itoa(elem.index) + "]")
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(elem.key)
+	}
+	return b.String()
+}
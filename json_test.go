@@ -0,0 +1,191 @@
+package uuidcrypt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runJSONLinesCrypt(t *testing.T, input string, processor Processor, options ...JSONOptions) string {
+	var output bytes.Buffer
+	err := NewJSONLinesCrypt(strings.NewReader(input), &output, processor, options...).Run()
+	failIfError(t, err)
+	return output.String()
+}
+
+func TestJSONLinesRoundTrip(t *testing.T) {
+	input := `{"user_id": "` + testUUID + `", "name":"tyler", "n": [1, 2.5e3, true, null]}` + "\n" +
+		"\n" +
+		`{"events":[{"user_id":"` + testUUID2 + `"},{"other":"` + testUUID + `"}],"user":{"id":"` + testUUID + `"}}` + "\r\n"
+	paths := WithJSONPaths("user_id", "events[].user_id", "user.id")
+	encrypted := runJSONLinesCrypt(t, input, newTestProcessor(testNamespace, EncryptType), paths)
+	lines := strings.Split(encrypted, "\n")
+	assert(t, len(lines) == 4, "line count should be preserved")
+	assert(t, !strings.Contains(lines[0], testUUID), "user_id should be encrypted")
+	assert(t, strings.HasPrefix(lines[0], `{"user_id": "`), "formatting should be preserved")
+	assert(t, strings.HasSuffix(lines[0], `", "name":"tyler", "n": [1, 2.5e3, true, null]}`), "other fields should be preserved")
+	assert(t, lines[1] == "", "blank lines should be preserved")
+	assert(t, !strings.Contains(lines[2], testUUID2), "array elements should be encrypted")
+	assert(t, strings.Contains(lines[2], `{"other":"`+testUUID+`"}`), "unselected fields should be untouched")
+	assert(t, strings.HasSuffix(lines[2], "}}\r"), "line endings should be preserved")
+
+	decrypted := runJSONLinesCrypt(t, encrypted, newTestProcessor(testNamespace, DecryptType), paths)
+	assert(t, decrypted == input, "decrypted output should match input: "+decrypted)
+}
+
+func TestJSONLinesPathProcessor(t *testing.T) {
+	input := `{"a":"` + testUUID + `","b":"` + testUUID + `"}` + "\n"
+	output := runJSONLinesCrypt(t, input, newTestProcessor(testNamespace, EncryptType),
+		WithJSONPaths("a"),
+		WithJSONPathProcessor("b", newTestProcessor("other", EncryptType)),
+	)
+	a, b, _ := strings.Cut(output, ",")
+	assert(t, a[6:42] != b[5:41], "paths should use different namespaces: "+output)
+}
+
+func TestJSONLinesErrorPolicies(t *testing.T) {
+	input := `{"id":"` + testUUID + `"}` + "\n" + `{"id":"nope"}` + "\n" + `{"id":1}` + "\n"
+	processor := newTestProcessor(testNamespace, EncryptType)
+	for _, tt := range []struct {
+		policy RowErrorPolicy
+		rest   []string
+	}{
+		{RowErrorPassthrough, []string{`{"id":"nope"}`, `{"id":1}`}},
+		{RowErrorBlank, []string{`{"id":""}`, `{"id":""}`}},
+		{RowErrorSkipRow, nil},
+	} {
+		output := runJSONLinesCrypt(t, input, processor, WithJSONPaths("id"), WithJSONErrorPolicy(tt.policy))
+		lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+		assert(t, len(lines) == 1+len(tt.rest), fmt.Sprintf("policy %d: unexpected output: %s", tt.policy, output))
+		for i, line := range tt.rest {
+			assert(t, lines[i+1] == line, fmt.Sprintf("policy %d: unexpected line %d: %s", tt.policy, i+2, lines[i+1]))
+		}
+	}
+
+	err := NewJSONLinesCrypt(strings.NewReader(input), &bytes.Buffer{}, processor, WithJSONPaths("id")).Run()
+	var e *Error
+	assert(t, errors.As(err, &e) && e.Kind == ParseError && e.Line == 2, "strict policy should fail on line 2")
+	for _, value := range []string{`1`, `null`, `{"a":"b"}`, `["` + testUUID + `"]`} {
+		err = NewJSONLinesCrypt(strings.NewReader(`{"id":`+value+`}`), &bytes.Buffer{}, processor, WithJSONPaths("id")).Run()
+		assert(t, errors.Is(err, ErrJSONNotString) && KindOf(err) == ParseError, fmt.Sprintf("selected non-string %s should be an error: %v", value, err))
+	}
+	output := runJSONLinesCrypt(t, `{"id":{"a":[1,"b"]},"n":2}`, processor, WithJSONPaths("id"), WithJSONErrorPolicy(RowErrorBlank))
+	assert(t, output == `{"id":"","n":2}`, "selected objects should be blanked: "+output)
+}
+
+func TestJSONLinesInvalid(t *testing.T) {
+	processor := newTestProcessor(testNamespace, EncryptType)
+	for _, input := range []string{`{"id":`, `{"id" "x"}`, `{} {}`, `[1,]`, `"\x"`, `{"a": tru}`, `nul`, `truex`, `01`, `1.`, `-`, `1e`, `.5`, `+1`, `[1x]`} {
+		err := NewJSONLinesCrypt(strings.NewReader("{}\n"+input), &bytes.Buffer{}, processor, WithJSONPaths("id")).Run()
+		var e *Error
+		assert(t, errors.As(err, &e) && e.Kind == ParseError && e.Line == 2, "expected parse error on line 2 for "+input)
+	}
+	literals := `[0,-0.5,1E+2,12e-3,true,false,null]` + "\n"
+	output := runJSONLinesCrypt(t, literals, processor, WithJSONPaths("id"))
+	assert(t, output == literals, "valid literals should be copied as is: "+output)
+	for _, path := range []string{"", "a..b", "a[", "a[0]"} {
+		err := NewJSONLinesCrypt(strings.NewReader("{}\n"), &bytes.Buffer{}, processor, WithJSONPaths(path)).Run()
+		assert(t, errors.Is(err, ErrInvalidJSONPath) && KindOf(err) == ConfigError, "expected invalid path error for "+path)
+	}
+}
+
+func TestJSONPathMatch(t *testing.T) {
+	key := func(k string) jsonPathElem { return jsonPathElem{key: k, index: -1} }
+	idx := func(i int) jsonPathElem { return jsonPathElem{index: i} }
+	for _, tt := range []struct {
+		selector string
+		path     []jsonPathElem
+		match    bool
+	}{
+		{"$.a.b", []jsonPathElem{key("a"), key("b")}, true},
+		{"$.a.b", []jsonPathElem{key("a")}, false},
+		{"$['a'][\"b.c\"]", []jsonPathElem{key("a"), key("b.c")}, true},
+		{"$.a[1]", []jsonPathElem{key("a"), idx(1)}, true},
+		{"$.a[1]", []jsonPathElem{key("a"), idx(0)}, false},
+		{"$.a[*].id", []jsonPathElem{key("a"), idx(3), key("id")}, true},
+		{"$.*", []jsonPathElem{key("a")}, true},
+		{"$.*", []jsonPathElem{idx(0)}, true},
+		{"$..id", []jsonPathElem{key("id")}, true},
+		{"$..id", []jsonPathElem{key("a"), idx(2), key("id")}, true},
+		{"$..id", []jsonPathElem{key("id"), key("x")}, false},
+		{"$..[0]", []jsonPathElem{key("a"), idx(0)}, true},
+		{"$.a..b.c", []jsonPathElem{key("a"), key("x"), key("b"), key("c")}, true},
+		{"$", nil, true},
+		{"a[].b", []jsonPathElem{key("a"), idx(5), key("b")}, true},
+	} {
+		selector, err := parseJSONSelector(tt.selector)
+		failIfError(t, err)
+		assert(t, selector.match(tt.path) == tt.match, fmt.Sprintf("%s should match %v: %v", tt.selector, tt.path, tt.match))
+	}
+	for _, selector := range []string{"$.", "$..", "$...a", "$a", "$[", "$[x]", "$[-1]", "$['a'", "$['a'x]", "$.a[1"} {
+		_, err := parseJSONSelector(selector)
+		assert(t, errors.Is(err, ErrInvalidJSONPath), "expected invalid path error for "+selector)
+	}
+}
+
+func TestJSONDocument(t *testing.T) {
+	input := "{\n  \"data\": [\n    {\"id\": \"" + testUUID + "\", \"org\": {\"id\": \"" + testUUID2 + "\"}},\n" +
+		"    {\"id\": \"" + testUUID2 + "\", \"note\": \"not a uuid\"}\n  ],\n  \"next\": null\n}\n"
+	encrypt := newTestProcessor(testNamespace, EncryptType)
+	decrypt := newTestProcessor(testNamespace, DecryptType)
+
+	selected := runJSONCrypt(t, input, encrypt, WithJSONPaths("$.data[*].id"))
+	assert(t, strings.Count(selected, testUUID2) == 1, "only the selected values should be encrypted: "+selected)
+	assert(t, runJSONCrypt(t, selected, decrypt, WithJSONPaths("$.data[*].id")) == input, "decrypted document should match input")
+
+	all := runJSONCrypt(t, input, encrypt, WithAllUUIDStrings())
+	assert(t, !strings.Contains(all, testUUID) && !strings.Contains(all, testUUID2), "every uuid should be encrypted: "+all)
+	assert(t, strings.Contains(all, `"note": "not a uuid"`), "other strings should be untouched")
+	assert(t, runJSONCrypt(t, all, decrypt, WithAllUUIDStrings()) == input, "decrypted document should match input")
+
+	err := NewJSONCrypt(strings.NewReader(input), &bytes.Buffer{}, encrypt, WithJSONPaths("$..note")).Run()
+	var e *Error
+	assert(t, errors.As(err, &e) && e.Kind == ParseError && e.Line == 4, fmt.Sprintf("expected parse error on line 4: %v", err))
+	err = NewJSONCrypt(strings.NewReader("{}\n{}"), &bytes.Buffer{}, encrypt, WithAllUUIDStrings()).Run()
+	assert(t, errors.Is(err, ErrInvalidJSON) && KindOf(err) == ParseError, "trailing values should be rejected")
+	err = NewJSONCrypt(strings.NewReader(" "), &bytes.Buffer{}, encrypt, WithAllUUIDStrings()).Run()
+	assert(t, errors.Is(err, ErrInvalidJSON), "empty documents should be rejected")
+	err = NewJSONCrypt(strings.NewReader(input), &bytes.Buffer{}, encrypt, WithAllUUIDStrings(), WithJSONErrorPolicy(RowErrorSkipRow)).Run()
+	assert(t, errors.Is(err, ErrJSONPolicyUnsupported) && KindOf(err) == ConfigError, "skip-row should be rejected for documents")
+}
+
+func runJSONCrypt(t *testing.T, input string, processor Processor, options ...JSONOptions) string {
+	var output bytes.Buffer
+	err := NewJSONCrypt(strings.NewReader(input), &output, processor, options...).Run()
+	failIfError(t, err)
+	return output.String()
+}
+
+func TestJSONAndTextErrorFile(t *testing.T) {
+	processor := newTestProcessor(testNamespace, EncryptType)
+	short := processorFunc(func(in []byte) []byte { return in[:8] })
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name, input  string
+		newUUIDCrypt func(io.Reader) UUIDCrypt
+	}{
+		{"lines.jsonl", "{}\n{\"id\":1}\n", func(r io.Reader) UUIDCrypt {
+			return NewJSONLinesCrypt(r, &bytes.Buffer{}, processor, WithJSONPaths("id"))
+		}},
+		{"doc.json", "{\n\"id\":", func(r io.Reader) UUIDCrypt {
+			return NewJSONCrypt(r, &bytes.Buffer{}, processor, WithJSONPaths("id"))
+		}},
+		{"app.log", "ok\nuser=" + testUUID + "\n", func(r io.Reader) UUIDCrypt {
+			return NewTextCrypt(r, &bytes.Buffer{}, short)
+		}},
+	} {
+		filename := filepath.Join(dir, tt.name)
+		failIfError(t, os.WriteFile(filename, []byte(tt.input), 0600))
+		r, err := OpenFile(filename)
+		failIfError(t, err)
+		err = tt.newUUIDCrypt(r).Run()
+		r.Close()
+		var e *Error
+		assert(t, errors.As(err, &e) && e.File == filename && e.Line == 2, fmt.Sprintf("%s: expected error on line 2 of the file: %v", tt.name, err))
+	}
+}
@@ -0,0 +1,319 @@
+package uuidcrypt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNoJSONPaths           = errors.New("json: no field paths to process")
+	ErrJSONPolicyUnsupported = errors.New("json: row error policy is not supported for json")
+	ErrJSONNotString         = errors.New("json: selected value is not a string")
+)
+
+// JSONOptions are optional parameters that can be provided to
+// NewJSONCrypt and NewJSONLinesCrypt to inform their configuration
+// when they run.
+type JSONOptions func(*jsonCrypt)
+
+// WithJSONPaths specifies which string values should be processed.
+// Paths starting with `$` are JSONPath selectors such as `$.user.id`,
+// `$['user']['id']`, `$.events[0]`, `$.events[*]`, `$.*` or `$..id`.
+// Other paths are dotted field paths such as `user_id`, `user.id` or
+// `events[].user_id`, where `[]` matches every element of an array.
+func WithJSONPaths(paths ...string) JSONOptions {
+	return func(j *jsonCrypt) {
+		for _, path := range paths {
+			j.addSelector(path, nil)
+		}
+	}
+}
+
+// WithJSONPathProcessor is like WithJSONPaths, but uses processor
+// instead of the default processor for values at the given path.
+func WithJSONPathProcessor(path string, processor Processor) JSONOptions {
+	return func(j *jsonCrypt) {
+		j.addSelector(path, processor)
+	}
+}
+
+// WithAllUUIDStrings processes every string value that is a UUID,
+// wherever it is, in addition to the values selected by path. Other
+// strings are left untouched.
+func WithAllUUIDStrings() JSONOptions {
+	return func(j *jsonCrypt) {
+		j.allUUIDs = true
+	}
+}
+
+// WithJSONErrorPolicy specifies what to do with selected values that
+// cannot be processed, including values selected by path that are not
+// strings, which RowErrorBlank replaces with an empty string. With
+// NewJSONLinesCrypt, RowErrorSkipRow skips the whole line; NewJSONCrypt
+// does not support it. RowErrorRejectFile is not supported.
+// RowErrorStrict is used if no policy is specified.
+func WithJSONErrorPolicy(policy RowErrorPolicy) JSONOptions {
+	return func(j *jsonCrypt) {
+		j.policy = policy
+	}
+}
+
+// WithJSONUUIDFormat specifies how processed UUIDs are written.
+// PreserveFormat is used if no format is specified.
+func WithJSONUUIDFormat(format UUIDFormat) JSONOptions {
+	return func(j *jsonCrypt) {
+		j.format = format
+	}
+}
+
+// NewJSONCrypt returns a UUIDCrypt object that reads a single JSON
+// document from input, processes the selected UUID string values, and
+// writes it to output. All other values, key order and formatting are
+// preserved byte for byte. The document is streamed, so it may be
+// larger than memory.
+func NewJSONCrypt(input io.Reader, output io.Writer, processor Processor, options ...JSONOptions) UUIDCrypt {
+	return newJSONCrypt(input, output, processor, false, options)
+}
+
+// NewJSONLinesCrypt is like NewJSONCrypt, but reads JSON Lines, where
+// each line holds a single JSON value. Blank lines are preserved.
+func NewJSONLinesCrypt(input io.Reader, output io.Writer, processor Processor, options ...JSONOptions) UUIDCrypt {
+	return newJSONCrypt(input, output, processor, true, options)
+}
+
+func newJSONCrypt(input io.Reader, output io.Writer, processor Processor, lines bool, options []JSONOptions) *jsonCrypt {
+	j := &jsonCrypt{
+		r:         bufio.NewReader(input),
+		w:         bufio.NewWriter(output),
+		file:      fileName(input),
+		processor: processor,
+		lines:     lines,
+		policy:    RowErrorStrict,
+		format:    PreserveFormat,
+	}
+	for _, opt := range options {
+		opt(j)
+	}
+	return j
+}
+
+// jsonSelection pairs a selector with the processor for the values it
+// selects, or nil for the default processor.
+type jsonSelection struct {
+	selector  jsonSelector
+	processor Processor
+}
+
+type jsonCrypt struct {
+	r          *bufio.Reader
+	w          *bufio.Writer
+	file       string
+	processor  Processor
+	selections []jsonSelection
+	allUUIDs   bool
+	lines      bool
+	policy     RowErrorPolicy
+	format     UUIDFormat
+	optionErr  error
+	buf        bytes.Buffer
+	line       int
+	skipLine   bool
+}
+
+func (j *jsonCrypt) addSelector(path string, processor Processor) {
+	selector, err := parseJSONSelector(path)
+	if err != nil {
+		j.optionErr = err
+		return
+	}
+	j.selections = append(j.selections, jsonSelection{selector: selector, processor: processor})
+}
+
+func (j *jsonCrypt) Run() error {
+	if err := j.validate(); err != nil {
+		return withKind(ConfigError, err)
+	}
+	if j.lines {
+		if err := j.runLines(); err != nil {
+			return err
+		}
+	} else if err := j.runDocument(); err != nil {
+		return err
+	}
+	if err := j.w.Flush(); err != nil {
+		return &Error{Kind: IOError, Err: err}
+	}
+	return nil
+}
+
+func (j *jsonCrypt) validate() error {
+	if j.optionErr != nil {
+		return j.optionErr
+	}
+	if len(j.selections) == 0 && !j.allUUIDs {
+		return ErrNoJSONPaths
+	}
+	if j.policy == RowErrorRejectFile || j.policy == RowErrorSkipRow && !j.lines {
+		return ErrJSONPolicyUnsupported
+	}
+	return nil
+}
+
+// runDocument rewrites a single JSON document, which may be surrounded
+// by whitespace.
+func (j *jsonCrypt) runDocument() error {
+	rewriter := &jsonRewriter{r: j.r, w: j.w, transform: j.transform, nonString: j.nonString}
+	err := rewriter.rewrite()
+	if err == io.EOF {
+		err = rewriter.unexpectedEOF(err)
+	}
+	if err == nil {
+		if c, readErr := j.r.ReadByte(); readErr == nil {
+			err = rewriter.invalid(c)
+		} else if readErr != io.EOF {
+			err = readErr
+		}
+	}
+	if err != nil {
+		return j.withLine(jsonErrorKind(err), rewriter.line+1)
+	}
+	return nil
+}
+
+func (j *jsonCrypt) runLines() error {
+	for {
+		line, err := j.r.ReadBytes('\n')
+		if len(line) > 0 {
+			j.line++
+			if err := j.processLine(line); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &Error{Kind: IOError, File: j.file, Line: j.line + 1, Err: err}
+		}
+	}
+}
+
+// processLine rewrites a single line, which must hold a single JSON
+// value or only whitespace.
+func (j *jsonCrypt) processLine(line []byte) error {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return j.write(line)
+	}
+	j.buf.Reset()
+	j.skipLine = false
+	r := bytes.NewReader(line)
+	rewriter := &jsonRewriter{r: r, w: &j.buf, transform: j.transform, nonString: j.nonString}
+	err := rewriter.rewrite()
+	if err == nil && r.Len() > 0 {
+		c, _ := r.ReadByte()
+		err = rewriter.invalid(c)
+	}
+	if err != nil {
+		return j.withLine(withKind(ParseError, err), j.line)
+	}
+	if j.skipLine {
+		return nil
+	}
+	return j.write(j.buf.Bytes())
+}
+
+func (j *jsonCrypt) write(b []byte) error {
+	if _, err := j.w.Write(b); err != nil {
+		return &Error{Kind: IOError, Err: err}
+	}
+	return nil
+}
+
+// transform processes the value if it is selected, handling values
+// that cannot be processed according to the error policy.
+func (j *jsonCrypt) transform(path []jsonPathElem, value string) (string, bool, error) {
+	processor := j.processorFor(path, value)
+	if processor == nil {
+		return "", false, nil
+	}
+	newValue, err := processUUIDString(processor, value, j.format)
+	if err == nil {
+		return newValue, true, nil
+	}
+	blank, err := j.valueError(path, err)
+	return "", blank, err
+}
+
+// nonString handles a value that is not a string, which cannot be a
+// UUID, according to the error policy if it is selected by path.
+func (j *jsonCrypt) nonString(path []jsonPathElem) (bool, error) {
+	for _, s := range j.selections {
+		if s.selector.match(path) {
+			return j.valueError(path, ErrJSONNotString)
+		}
+	}
+	return false, nil
+}
+
+// valueError handles a selected value that cannot be processed
+// according to the error policy, and reports whether to blank it.
+func (j *jsonCrypt) valueError(path []jsonPathElem, err error) (bool, error) {
+	switch j.policy {
+	case RowErrorPassthrough:
+		return false, nil
+	case RowErrorBlank:
+		return true, nil
+	case RowErrorSkipRow:
+		j.skipLine = true
+		return false, nil
+	}
+	kind := ParseError
+	if errors.Is(err, ErrBadProcessorOutput) {
+		kind = CryptoError
+	}
+	return false, &Error{Kind: kind, File: j.file, Err: fmt.Errorf("%s: %w", formatJSONPath(path), err)}
+}
+
+// processorFor returns the processor for the value at path, or nil if
+// the value is not selected.
+func (j *jsonCrypt) processorFor(path []jsonPathElem, value string) Processor {
+	for _, s := range j.selections {
+		if !s.selector.match(path) {
+			continue
+		}
+		if s.processor != nil {
+			return s.processor
+		}
+		return j.processor
+	}
+	if j.allUUIDs && uuid.Validate(value) == nil {
+		return j.processor
+	}
+	return nil
+}
+
+// jsonErrorKind wraps an error returned while rewriting a document
+// according to whether it came from the document or the underlying
+// reader or writer.
+func jsonErrorKind(err error) error {
+	if errors.Is(err, ErrInvalidJSON) {
+		return withKind(ParseError, err)
+	}
+	return withKind(IOError, err)
+}
+
+// withLine records the input file and line an error occurred on.
+func (j *jsonCrypt) withLine(err error, line int) error {
+	var e *Error
+	if errors.As(err, &e) {
+		e.File = j.file
+		e.Line = line
+		return e
+	}
+	return &Error{Kind: ParseError, File: j.file, Line: line, Err: err}
+}
@@ -0,0 +1,145 @@
+package uuidcrypt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// anyChild matches any member of an object or element of an array.
+const anyChild = -3
+
+// jsonPathStep is one step of a JSONPath selector. A descendant step
+// matches at any depth below the previous step.
+type jsonPathStep struct {
+	elem       jsonPathElem
+	descendant bool
+}
+
+func (s jsonPathStep) matchElem(elem jsonPathElem) bool {
+	switch {
+	case s.elem.index == anyChild:
+		return true
+	case s.elem.index >= 0:
+		return elem.index == s.elem.index
+	}
+	return elem.index < 0 && elem.key == s.elem.key
+}
+
+// jsonPath is a jsonSelector for JSONPath selectors such as `$.a.b`,
+// `$['a'][0]`, `$.a[*]`, `$.*` or `$..id`.
+type jsonPath []jsonPathStep
+
+func (p jsonPath) match(path []jsonPathElem) bool {
+	if len(p) == 0 {
+		return len(path) == 0
+	}
+	step := p[0]
+	if !step.descendant {
+		return len(path) > 0 && step.matchElem(path[0]) && p[1:].match(path[1:])
+	}
+	for i := range path {
+		if step.matchElem(path[i]) && p[1:].match(path[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseJSONSelector parses either a JSONPath selector, which starts
+// with `$`, or a dotted field path.
+func parseJSONSelector(selector string) (jsonSelector, error) {
+	if strings.HasPrefix(selector, "$") {
+		return parseJSONPath(selector)
+	}
+	return parseFieldPath(selector)
+}
+
+func parseJSONPath(selector string) (jsonPath, error) {
+	invalid := fmt.Errorf("%w: %q", ErrInvalidJSONPath, selector)
+	s := strings.TrimPrefix(selector, "$")
+	var p jsonPath
+	for s != "" {
+		var step jsonPathStep
+		switch {
+		case strings.HasPrefix(s, ".."):
+			step.descendant = true
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				break
+			}
+			if strings.HasPrefix(s, ".") {
+				return nil, invalid
+			}
+			fallthrough
+		case strings.HasPrefix(s, "."):
+			s = strings.TrimPrefix(s, ".")
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			switch name {
+			case "":
+				return nil, invalid
+			case "*":
+				step.elem = jsonPathElem{index: anyChild}
+			default:
+				step.elem = jsonPathElem{key: name, index: -1}
+			}
+			p = append(p, step)
+			continue
+		case !strings.HasPrefix(s, "["):
+			return nil, invalid
+		}
+		elem, rest, ok := parseJSONPathBracket(s)
+		if !ok {
+			return nil, invalid
+		}
+		step.elem = elem
+		s = rest
+		p = append(p, step)
+	}
+	return p, nil
+}
+
+// parseJSONPathBracket parses a bracketed step at the start of s, i.e.
+// `[*]`, an index such as `[0]`, or a quoted key such as `['a']`, and
+// returns the rest of s.
+func parseJSONPathBracket(s string) (jsonPathElem, string, bool) {
+	s = s[1:]
+	if s == "" {
+		return jsonPathElem{}, "", false
+	}
+	if quote := s[0]; quote == '\'' || quote == '"' {
+		var key strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch {
+			case s[i] == '\\' && i+1 < len(s):
+				i++
+				key.WriteByte(s[i])
+			case s[i] == quote:
+				if !strings.HasPrefix(s[i+1:], "]") {
+					return jsonPathElem{}, "", false
+				}
+				return jsonPathElem{key: key.String(), index: -1}, s[i+2:], true
+			default:
+				key.WriteByte(s[i])
+			}
+		}
+		return jsonPathElem{}, "", false
+	}
+	inner, rest, ok := strings.Cut(s, "]")
+	if !ok {
+		return jsonPathElem{}, "", false
+	}
+	if inner == "*" {
+		return jsonPathElem{index: anyChild}, rest, true
+	}
+	index, err := strconv.Atoi(inner)
+	if err != nil || index < 0 || strings.HasPrefix(inner, "+") {
+		return jsonPathElem{}, "", false
+	}
+	return jsonPathElem{index: index}, rest, true
+}
@@ -0,0 +1,250 @@
+package uuidcrypt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidKeyring    = errors.New("keyring: invalid keyring")
+	ErrUnknownKey        = errors.New("keyring: unknown key")
+	ErrUnknownKeyStatus  = errors.New("keyring: unknown key status")
+	ErrNoActiveKey       = errors.New("keyring: no active version of key")
+	ErrKeyDecryptOnly    = errors.New("keyring: key may only be used to decrypt")
+	ErrKeyRetired        = errors.New("keyring: key is retired")
+	ErrInvalidKeyID      = errors.New("keyring: invalid key id")
+	ErrDuplicateKeyEntry = errors.New("keyring: duplicate key")
+	ErrKeyVersionNeeded  = errors.New("keyring: decrypting requires a key id with a version, name:version")
+)
+
+// KeyStatus decides what a key in a keyring may be used for.
+type KeyStatus int
+
+const (
+	// KeyActive keys may be used to encrypt and decrypt.
+	KeyActive KeyStatus = 1 + iota
+
+	// KeyDecryptOnly keys may only be used to decrypt, e.g. while
+	// data is rotated to a newer key.
+	KeyDecryptOnly
+
+	// KeyRetired keys may not be used at all.
+	KeyRetired
+)
+
+// ParseKeyStatus returns the KeyStatus named by str: "active",
+// "decrypt-only" or "retired".
+func ParseKeyStatus(str string) (KeyStatus, error) {
+	switch str {
+	case "active":
+		return KeyActive, nil
+	case "decrypt-only":
+		return KeyDecryptOnly, nil
+	case "retired":
+		return KeyRetired, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownKeyStatus, str)
+}
+
+func (s KeyStatus) String() string {
+	switch s {
+	case KeyActive:
+		return "active"
+	case KeyDecryptOnly:
+		return "decrypt-only"
+	case KeyRetired:
+		return "retired"
+	}
+	return "unknown"
+}
+
+// Key is a named, versioned secret in a keyring, along with how keys
+// are derived from it.
+type Key struct {
+	Name    string
+	Version int
+	Secret  []byte
+	Created time.Time
+	Status  KeyStatus
+	KDF     KDFVersion
+	KeySize int
+	Stretch Stretch
+}
+
+// ID returns the ID of the key, its name and version as `name:version`.
+func (k Key) ID() string {
+	return k.Name + ":" + strconv.Itoa(k.Version)
+}
+
+// options returns the processor options for deriving keys from k.
+func (k Key) options() []ProcessorOptions {
+	return []ProcessorOptions{WithKDF(k.KDF), WithKeySize(k.KeySize), WithStretch(k.Stretch)}
+}
+
+// Keyring holds named, versioned secrets.
+type Keyring struct {
+	keys []Key
+}
+
+// keyringFile is the JSON format of a keyring file, e.g.
+//
+//	{
+//	  "keys": [
+//	    {
+//	      "name": "exports",
+//	      "version": 2,
+//	      "secret": "...",
+//	      "created": "2024-06-01T00:00:00Z",
+//	      "status": "active",
+//	      "kdf": "v2",
+//	      "key_size": 256,
+//	      "stretch": "argon2id",
+//	      "stretch_params": "t=3,m=65536,p=4"
+//	    }
+//	  ]
+//	}
+//
+// kdf, key_size, stretch, stretch_params and stretch_salt are
+// optional, and default as they do on the command line.
+type keyringFile struct {
+	Keys []struct {
+		Name          string    `json:"name"`
+		Version       int       `json:"version"`
+		Secret        string    `json:"secret"`
+		Created       time.Time `json:"created"`
+		Status        string    `json:"status"`
+		KDF           string    `json:"kdf"`
+		KeySize       int       `json:"key_size"`
+		Stretch       string    `json:"stretch"`
+		StretchParams string    `json:"stretch_params"`
+		StretchSalt   string    `json:"stretch_salt"`
+	} `json:"keys"`
+}
+
+// LoadKeyring reads a keyring from the named JSON file.
+func LoadKeyring(filename string) (*Keyring, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	k, err := ReadKeyring(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return k, nil
+}
+
+// ReadKeyring reads a keyring in JSON from r. Every key must have a
+// name, a positive version unique for its name, a secret and a
+// status.
+func ReadKeyring(r io.Reader) (*Keyring, error) {
+	var file keyringFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeyring, err)
+	}
+	k := &Keyring{}
+	ids := make(map[string]bool)
+	for _, entry := range file.Keys {
+		key := Key{
+			Name:    entry.Name,
+			Version: entry.Version,
+			Secret:  []byte(entry.Secret),
+			Created: entry.Created,
+			KeySize: entry.KeySize,
+		}
+		if key.Name == "" || strings.Contains(key.Name, ":") || key.Version < 1 || len(key.Secret) == 0 {
+			return nil, fmt.Errorf("%w: key %q needs a name without a colon, a positive version and a secret", ErrInvalidKeyring, key.ID())
+		}
+		if ids[key.ID()] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateKeyEntry, key.ID())
+		}
+		ids[key.ID()] = true
+		if err := parseKeyEntry(&key, entry.Status, entry.KDF, entry.Stretch, entry.StretchParams); err != nil {
+			return nil, fmt.Errorf("%s: %w", key.ID(), err)
+		}
+		if entry.StretchSalt != "" {
+			key.Stretch.Salt = []byte(entry.StretchSalt)
+		}
+		k.keys = append(k.keys, key)
+	}
+	return k, nil
+}
+
+func parseKeyEntry(key *Key, status, kdf, stretch, stretchParams string) error {
+	var err error
+	if key.Status, err = ParseKeyStatus(status); err != nil {
+		return err
+	}
+	if key.KDF, err = ParseKDFVersion(kdf); err != nil {
+		return err
+	}
+	if key.KeySize == 0 {
+		key.KeySize = DefaultKeySize
+	}
+	if err := ValidateKeySize(key.KDF, key.KeySize); err != nil {
+		return err
+	}
+	key.Stretch, err = ParseStretch(stretch, stretchParams)
+	return err
+}
+
+// Key returns the key with the given ID, either `name:version`, or
+// just `name` for the latest active version of the key.
+func (k *Keyring) Key(id string) (Key, error) {
+	name, version, hasVersion := strings.Cut(id, ":")
+	if !hasVersion {
+		var latest *Key
+		for i, key := range k.keys {
+			if key.Name == name && key.Status == KeyActive && (latest == nil || key.Version > latest.Version) {
+				latest = &k.keys[i]
+			}
+		}
+		if latest == nil {
+			return Key{}, fmt.Errorf("%w: %q", ErrNoActiveKey, id)
+		}
+		return *latest, nil
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		return Key{}, fmt.Errorf("%w: %q", ErrInvalidKeyID, id)
+	}
+	for _, key := range k.keys {
+		if key.Name == name && key.Version == v {
+			return key, nil
+		}
+	}
+	return Key{}, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+}
+
+// Processor returns a processor like NewCrypterProcessor for the key
+// with the given ID and the namespace. Only active keys may be used to
+// encrypt, and only active and decrypt-only keys to decrypt. Data must
+// be decrypted with the exact version it was encrypted with, so
+// decrypting requires an id with a version, rather than one that
+// resolves to whichever version is now the latest. Options such as
+// WithValidUUIDs are applied after those of the key.
+func (k *Keyring) Processor(id string, namespace []byte, cryptType CryptType, options ...ProcessorOptions) (Processor, error) {
+	if cryptType == DecryptType && !strings.Contains(id, ":") {
+		return nil, fmt.Errorf("%w: %q", ErrKeyVersionNeeded, id)
+	}
+	key, err := k.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case key.Status == KeyRetired:
+		return nil, fmt.Errorf("%w: %s", ErrKeyRetired, key.ID())
+	case key.Status == KeyDecryptOnly && cryptType != DecryptType:
+		return nil, fmt.Errorf("%w: %s", ErrKeyDecryptOnly, key.ID())
+	}
+	return newCrypterProcessor(key.Secret, namespace, cryptType, append(key.options(), options...)...)
+}
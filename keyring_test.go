@@ -0,0 +1,81 @@
+package uuidcrypt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testKeyring = `{
+  "keys": [
+    {"name": "exports", "version": 1, "secret": "old", "created": "2023-01-01T00:00:00Z", "status": "decrypt-only"},
+    {"name": "exports", "version": 2, "secret": "` + testSecret + `", "created": "2024-01-01T00:00:00Z", "status": "active", "kdf": "v2", "key_size": 256},
+    {"name": "exports", "version": 3, "secret": "next", "created": "2025-01-01T00:00:00Z", "status": "retired"},
+    {"name": "stretched", "version": 1, "secret": "` + testSecret + `", "created": "2024-01-01T00:00:00Z", "status": "active", "stretch": "scrypt", "stretch_params": "N=16,r=8,p=1"}
+  ]
+}`
+
+func TestKeyring(t *testing.T) {
+	k, err := ReadKeyring(strings.NewReader(testKeyring))
+	failIfError(t, err)
+
+	key, err := k.Key("exports")
+	failIfError(t, err)
+	assert(t, key.ID() == "exports:2", "the latest active version should be used, got "+key.ID())
+	assert(t, key.KDF == KDFv2 && key.KeySize == 256, "key derivation should be read from the keyring")
+	key, err = k.Key("exports:1")
+	failIfError(t, err)
+	assert(t, key.Status == KeyDecryptOnly && key.KeySize == DefaultKeySize, "versions should be selected by id")
+
+	enc, err := k.Processor("exports", []byte(testNamespace), EncryptType)
+	failIfError(t, err)
+	expected := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType, WithKDF(KDFv2), WithKeySize(256))
+	assert(t, bytes.Equal(enc.Process(testBlock), expected.Process(testBlock)), "keyring processor should use the key's secret and derivation")
+	dec, err := k.Processor("exports:2", []byte(testNamespace), DecryptType)
+	failIfError(t, err)
+	assert(t, bytes.Equal(dec.Process(enc.Process(testBlock)), testBlock), "decrypted text should match plaintext")
+
+	stretched, err := k.Processor("stretched", []byte(testNamespace), EncryptType)
+	failIfError(t, err)
+	expected = NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType, WithStretch(testScrypt))
+	assert(t, bytes.Equal(stretched.Process(testBlock), expected.Process(testBlock)), "keyring processor should stretch the secret")
+
+	_, err = k.Processor("exports:1", []byte(testNamespace), DecryptType)
+	failIfError(t, err)
+	for _, tt := range []struct {
+		id        string
+		cryptType CryptType
+		err       error
+	}{
+		{"exports:1", EncryptType, ErrKeyDecryptOnly},
+		{"exports:3", DecryptType, ErrKeyRetired},
+		{"exports:4", DecryptType, ErrUnknownKey},
+		{"exports:x", DecryptType, ErrInvalidKeyID},
+		{"imports", EncryptType, ErrNoActiveKey},
+		{"exports", DecryptType, ErrKeyVersionNeeded},
+	} {
+		_, err := k.Processor(tt.id, []byte(testNamespace), tt.cryptType)
+		assert(t, errors.Is(err, tt.err), "unexpected error for "+tt.id)
+	}
+}
+
+func TestReadKeyringErrors(t *testing.T) {
+	for _, tt := range []struct {
+		keyring string
+		err     error
+	}{
+		{`{"keys": [`, ErrInvalidKeyring},
+		{`{"keys": [{"name": "a", "version": 1, "secret": "s", "status": "active", "owner": "me"}]}`, ErrInvalidKeyring},
+		{`{"keys": [{"name": "a", "version": 0, "secret": "s", "status": "active"}]}`, ErrInvalidKeyring},
+		{`{"keys": [{"name": "a:b", "version": 1, "secret": "s", "status": "active"}]}`, ErrInvalidKeyring},
+		{`{"keys": [{"name": "a", "version": 1, "status": "active"}]}`, ErrInvalidKeyring},
+		{`{"keys": [{"name": "a", "version": 1, "secret": "s", "status": "expired"}]}`, ErrUnknownKeyStatus},
+		{`{"keys": [{"name": "a", "version": 1, "secret": "s", "status": "active", "kdf": "v1", "key_size": 256}]}`, ErrUnsupportedKeySize},
+		{`{"keys": [{"name": "a", "version": 1, "secret": "s", "status": "active", "stretch": "bcrypt"}]}`, ErrUnknownStretch},
+		{`{"keys": [{"name": "a", "version": 1, "secret": "s", "status": "active"}, {"name": "a", "version": 1, "secret": "t", "status": "retired"}]}`, ErrDuplicateKeyEntry},
+	} {
+		_, err := ReadKeyring(strings.NewReader(tt.keyring))
+		assert(t, errors.Is(err, tt.err), "unexpected error for "+tt.keyring)
+	}
+}
@@ -0,0 +1,114 @@
+package uuidcrypt
+
+import "sync"
+
+// batchSize is the number of records read and processed at a time.
+const batchSize = 256
+
+// batch is a run of consecutive records, along with the lines they
+// began on and, once done is closed, their processed cells. err is the
+// error that ended reading after the records, if any.
+type batch struct {
+	records [][]string
+	lines   []int
+	cells   [][]cell
+	err     error
+	done    chan struct{}
+}
+
+// runParallel reads batches of records, processes them across the
+// workers, and writes them in their original order. At most a few
+// batches per worker are held in memory at a time.
+func (u *uuidCrypt) runParallel() error {
+	jobs := make(chan *batch, u.workers)
+	results := make(chan *batch, 2*u.workers)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1 + u.workers)
+	go func() {
+		defer wg.Done()
+		u.readBatches(jobs, results, stop)
+	}()
+	for i := 0; i < u.workers; i++ {
+		go func() {
+			defer wg.Done()
+			for b := range jobs {
+				u.processBatch(b)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(stop)
+	for b := range results {
+		<-b.done
+		if err := u.writeBatch(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runBatches reads, processes and writes one batch of records at a
+// time.
+func (u *uuidCrypt) runBatches() error {
+	for {
+		b := u.readBatch()
+		u.processBatch(b)
+		if err := u.writeBatch(b); err != nil {
+			return err
+		}
+	}
+}
+
+// readBatches sends each batch read to both the workers and, to keep
+// them in order, the writer, until reading fails or stop is closed.
+func (u *uuidCrypt) readBatches(jobs, results chan<- *batch, stop <-chan struct{}) {
+	defer close(results)
+	defer close(jobs)
+	for {
+		b := u.readBatch()
+		select {
+		case jobs <- b:
+		case <-stop:
+			return
+		}
+		select {
+		case results <- b:
+		case <-stop:
+			return
+		}
+		if b.err != nil {
+			return
+		}
+	}
+}
+
+func (u *uuidCrypt) readBatch() *batch {
+	b := &batch{done: make(chan struct{})}
+	for len(b.records) < batchSize {
+		record, err := u.read()
+		if err != nil {
+			b.err = err
+			break
+		}
+		b.records = append(b.records, record)
+		b.lines = append(b.lines, u.line())
+	}
+	return b
+}
+
+func (u *uuidCrypt) processBatch(b *batch) {
+	b.cells = u.processRecords(b.records)
+	close(b.done)
+}
+
+// writeBatch writes the processed records of the batch, and then
+// returns the error that ended reading them, if any.
+func (u *uuidCrypt) writeBatch(b *batch) error {
+	for i, record := range b.records {
+		if err := u.writeRecord(b.lines[i], record, b.cells[i]); err != nil {
+			return err
+		}
+	}
+	return b.err
+}
@@ -0,0 +1,47 @@
+package uuidcrypt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// testRows returns n rows of random UUIDs and tenants, where every
+// 97th UUID cannot be processed.
+func testRows(n int) [][]string {
+	rows := make([][]string, n)
+	for i := range rows {
+		id := uuid.NewString()
+		if i%97 == 50 {
+			id = "NULL"
+		}
+		rows[i] = []string{id, fmt.Sprintf("tenant-%d", i%7)}
+	}
+	return rows
+}
+
+func TestWorkersMatchSequential(t *testing.T) {
+	rows := testRows(5 * batchSize)
+	processor := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType)
+	for _, options := range [][]UUIDCryptOptions{
+		{WithRowErrorPolicy(RowErrorSkipRow)},
+		{WithRowErrorPolicy(RowErrorBlank), WithContextColumn(2)},
+		{WithHeader(), WithRowErrorPolicy(RowErrorPassthrough)},
+	} {
+		sequential := runUUIDCrypt(t, rows, processor, options...)
+		parallel := runUUIDCrypt(t, rows, processor, append(options, WithWorkers(4))...)
+		assert(t, reflect.DeepEqual(sequential, parallel), "parallel output should match sequential output")
+	}
+}
+
+func TestWorkersRowError(t *testing.T) {
+	rows := testRows(3 * batchSize)
+	output := &memFile{}
+	err := NewUUIDCrypt(&memFile{rows: rows}, output, newTestProcessor(testNamespace, EncryptType), WithWorkers(3)).Run()
+	var e *Error
+	assert(t, errors.As(err, &e) && e.Line == 51 && e.Column == 1, fmt.Sprintf("expected error on line 51: %v", err))
+	assert(t, len(output.rows) == 50, fmt.Sprintf("rows before the error should be written: %d", len(output.rows)))
+}
@@ -0,0 +1,49 @@
+package uuidcrypt
+
+import "errors"
+
+var (
+	ErrUnknownRowErrorPolicy = errors.New("policy: unknown row error policy")
+)
+
+// RowErrorPolicy decides what UUIDCrypt does with a row containing a
+// value that cannot be processed, such as a blank or `NULL`.
+type RowErrorPolicy int
+
+const (
+	// RowErrorStrict stops processing and returns the error.
+	RowErrorStrict RowErrorPolicy = 1 + iota
+
+	// RowErrorPassthrough leaves the bad value untouched.
+	RowErrorPassthrough
+
+	// RowErrorBlank replaces the bad value with an empty string.
+	RowErrorBlank
+
+	// RowErrorSkipRow leaves the row out of the output.
+	RowErrorSkipRow
+
+	// RowErrorRejectFile leaves the row out of the output and writes
+	// it, prefixed with its line number, to a reject file.
+	RowErrorRejectFile
+)
+
+var rowErrorPolicies = map[string]RowErrorPolicy{
+	"strict":      RowErrorStrict,
+	"passthrough": RowErrorPassthrough,
+	"blank":       RowErrorBlank,
+	"skip-row":    RowErrorSkipRow,
+	"reject-file": RowErrorRejectFile,
+}
+
+// ParseRowErrorPolicy returns the RowErrorPolicy named by str, e.g.
+// "skip-row". An empty string is RowErrorStrict.
+func ParseRowErrorPolicy(str string) (RowErrorPolicy, error) {
+	if str == "" {
+		return RowErrorStrict, nil
+	}
+	if policy, ok := rowErrorPolicies[str]; ok {
+		return policy, nil
+	}
+	return 0, ErrUnknownRowErrorPolicy
+}
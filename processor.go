@@ -1,9 +1,22 @@
-package main
+package uuidcrypt
 
 import (
+	"container/list"
 	"crypto/aes"
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	ErrUnknownKDF         = errors.New("processor: unknown key derivation version")
+	ErrUnsupportedKeySize = errors.New("processor: unsupported key size")
 )
 
 type CryptType int
@@ -13,48 +26,448 @@ const (
 	DecryptType
 )
 
+// KDFVersion selects the scheme used to derive an encryption key
+// from a secret and a namespace.
+type KDFVersion int
+
+const (
+	// KDFv1 is the legacy HMAC-MD5 derivation. It is kept for
+	// compatibility with data encrypted by earlier versions.
+	KDFv1 KDFVersion = 1 + iota
+
+	// KDFv2 derives keys with HKDF-SHA256, using the namespace as
+	// the salt and a fixed info label.
+	KDFv2
+)
+
+// hkdfInfo is the HKDF info label used by KDFv2. Changing it
+// changes every derived key.
+const hkdfInfo = "uuidcrypt kdf v2"
+
+// ParseKDFVersion returns the KDFVersion named by str, e.g. "v2".
+func ParseKDFVersion(str string) (KDFVersion, error) {
+	switch str {
+	case "v1", "":
+		return KDFv1, nil
+	case "v2":
+		return KDFv2, nil
+	}
+	return 0, ErrUnknownKDF
+}
+
+// DefaultKeySize is the AES key size, in bits, used when no key size
+// is specified.
+const DefaultKeySize = 128
+
+// ValidateKeySize checks that an AES key of the given size in bits
+// can be derived with kdf. KDFv1 only produces 128-bit keys.
+func ValidateKeySize(kdf KDFVersion, bits int) error {
+	switch bits {
+	case 128:
+		return nil
+	case 192, 256:
+		if kdf == KDFv1 {
+			return ErrUnsupportedKeySize
+		}
+		return nil
+	}
+	return ErrUnsupportedKeySize
+}
+
 // Processor is an object that can run some transformation over a
 // slice of bytes.
 type Processor interface {
 	Process([]byte) []byte
 }
 
+// ContextProcessor is a Processor that can be bound to a context,
+// such as a tenant ID, so that the same data is transformed
+// differently under different contexts.
+type ContextProcessor interface {
+	Processor
+	WithContext(context []byte) Processor
+}
+
+// BatchProcessor is a Processor that can transform many 16-byte UUIDs
+// at once, amortising the cost of each call. ProcessBatch processes
+// each 16-byte block of src into the same offset of dst, which must be
+// at least as long as src. dst and src may be the same slice.
+type BatchProcessor interface {
+	Processor
+	ProcessBatch(dst, src []byte)
+}
+
+// ProcessBatch processes each 16-byte block of src into dst, using a
+// single call if p is a BatchProcessor, or else one call per block.
+// It returns nil if every block was processed, or else one error per
+// block, which is ErrBadProcessorOutput for blocks that p did not
+// process into 16 bytes and nil for the others.
+func ProcessBatch(p Processor, dst, src []byte) []error {
+	switch bp := p.(type) {
+	case chainProcessor:
+		return bp.processBatch(dst, src)
+	case BatchProcessor:
+		bp.ProcessBatch(dst, src)
+		return nil
+	}
+	var errs []error
+	for i := 0; i+uuidSize <= len(src); i += uuidSize {
+		out := p.Process(src[i : i+uuidSize])
+		if len(out) != uuidSize {
+			if errs == nil {
+				errs = make([]error, len(src)/uuidSize)
+			}
+			errs[i/uuidSize] = fmt.Errorf("%w: invalid UUID (got %d bytes)", ErrBadProcessorOutput, len(out))
+			continue
+		}
+		copy(dst[i:i+uuidSize], out)
+	}
+	return errs
+}
+
+// mergeBlockErrors adds the errors of b to a, keeping the first error
+// of each block.
+func mergeBlockErrors(a, b []error) []error {
+	if a == nil {
+		return b
+	}
+	for i, err := range b {
+		if a[i] == nil {
+			a[i] = err
+		}
+	}
+	return a
+}
+
+// uuidSize is the size in bytes of a UUID, and of an AES block.
+const uuidSize = 16
+
+// ProcessorOptions are optional parameters that can be provided
+// to NewCrypterProcessor to inform how keys are derived.
+type ProcessorOptions func(*crypterProcessor)
+
+// WithKDF specifies which key derivation scheme to use. KDFv1 is
+// used if no scheme is specified.
+func WithKDF(kdf KDFVersion) ProcessorOptions {
+	return func(p *crypterProcessor) {
+		p.kdf = kdf
+	}
+}
+
+// WithValidUUIDs makes the processor preserve the version and
+// variant bits of each UUID, encrypting only the remaining 122 bits,
+// so that its output is always a valid RFC 4122 UUID of the same
+// version as its input. Data encrypted in this mode must also be
+// decrypted in this mode. The mode uses its own key, derived from the
+// usual one, so it never shares a key with the default mode.
+func WithValidUUIDs() ProcessorOptions {
+	return func(p *crypterProcessor) {
+		p.validUUIDs = true
+	}
+}
+
+// WithKeySize specifies the AES key size in bits: 128, 192 or 256.
+// Data must be decrypted with the same key size it was encrypted
+// with. The size is not recorded in the output, which has no room for
+// it, so callers must record it alongside the secret; decrypting with
+// another size gives wrong UUIDs rather than an error. A 128-bit key
+// is used if no size is specified.
+func WithKeySize(bits int) ProcessorOptions {
+	return func(p *crypterProcessor) {
+		p.keySize = bits
+	}
+}
+
+// WithStretch stretches the secret with scrypt or Argon2id before keys
+// are derived from it, to protect human-chosen secrets against
+// brute-force attacks. The secret is stretched once per processor,
+// including for all the contexts it is bound to. Data must be
+// decrypted with the same stretching it was encrypted with.
+func WithStretch(stretch Stretch) ProcessorOptions {
+	return func(p *crypterProcessor) {
+		p.stretch = stretch
+	}
+}
+
 // NewCrypterProcessor uses the secret and namespace provided to run
 // a two-way encryption or decryption during Process(). The cryptType
 // argument determines whether to encrypt or decrypt.
 //
-// The secret is used to create a 128-bit MD5 HMAC of the namespace.
-// The resulting hash is used as the key for encrypting and
-// decrypting data using an AES-128 ECB cipher.
+// By default, the secret is used to create a 128-bit MD5 HMAC of the
+// namespace (KDFv1). With WithKDF(KDFv2), the key is instead derived
+// with HKDF-SHA256. The resulting key is used for encrypting and
+// decrypting data using an AES ECB cipher, AES-128 unless a larger
+// key is requested with WithKeySize. With WithValidUUIDs, a
+// format-preserving Feistel cipher is used instead of ECB.
+//
+// It panics if the key size is not supported by the KDF or the
+// stretching parameters are invalid; use ValidateKeySize and
+// ValidateStretch to check user input beforehand, or use NewCrypter.
 //
 // Data passed to Process() should be 16 bytes in length.
-func NewCrypterProcessor(secret, namespace []byte, cryptType CryptType) Processor {
-	key := keyGen(secret, namespace)
-	block, err := aes.NewCipher(key)
+func NewCrypterProcessor(secret, namespace []byte, cryptType CryptType, options ...ProcessorOptions) Processor {
+	p, err := newCrypterProcessor(secret, namespace, cryptType, options...)
 	if err != nil {
 		panic(err)
 	}
-	cipher := NewECB(block)
-	return &crypterProcessor{
-		key:       key,
-		cipher:    cipher,
+	return p
+}
+
+func newCrypterProcessor(secret, namespace []byte, cryptType CryptType, options ...ProcessorOptions) (*crypterProcessor, error) {
+	p := &crypterProcessor{
+		secret:    secret,
+		namespace: namespace,
+		options:   options,
 		cryptType: cryptType,
+		kdf:       KDFv1,
+		keySize:   DefaultKeySize,
+	}
+	for _, opt := range options {
+		opt(p)
+	}
+	if err := ValidateKeySize(p.kdf, p.keySize); err != nil {
+		return nil, err
 	}
+	stretched, err := p.stretch.stretch(secret, namespace)
+	if err != nil {
+		return nil, err
+	}
+	// keys for contexts are derived from the stretched secret.
+	p.secret = stretched
+	p.options = append(p.options[:len(p.options):len(p.options)], WithStretch(Stretch{}))
+	key, err := keyGen(p.kdf, stretched, namespace, p.keySize/8)
+	if err != nil {
+		return nil, err
+	}
+	if p.validUUIDs {
+		if key, err = fpeKey(key); err != nil {
+			return nil, err
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	p.key = key
+	if p.validUUIDs {
+		p.cipher = NewUUIDFeistel(block)
+	} else {
+		p.cipher = NewECB(block)
+	}
+	return p, nil
+}
+
+// blockCrypter encrypts and decrypts 16-byte blocks.
+type blockCrypter interface {
+	Encrypt([]byte) []byte
+	Decrypt([]byte) []byte
+	EncryptBlocks(dst, src []byte)
+	DecryptBlocks(dst, src []byte)
 }
 
 type crypterProcessor struct {
-	key       []byte
-	cipher    *ECB
-	cryptType CryptType
-	nonce     []byte
+	secret     []byte
+	namespace  []byte
+	options    []ProcessorOptions
+	mu         sync.Mutex
+	contexts   contextCache
+	key        []byte
+	cipher     blockCrypter
+	cryptType  CryptType
+	kdf        KDFVersion
+	keySize    int
+	validUUIDs bool
+	stretch    Stretch
+	nonce      []byte
 }
 
-func keyGen(secret, namespace []byte) []byte {
+func keyGen(kdf KDFVersion, secret, namespace []byte, size int) ([]byte, error) {
+	switch kdf {
+	case KDFv1:
+		if size != md5.Size {
+			return nil, ErrUnsupportedKeySize
+		}
+		return keyGenHMACMD5(secret, namespace), nil
+	case KDFv2:
+		return keyGenHKDF(secret, namespace, size)
+	}
+	return nil, ErrUnknownKDF
+}
+
+func keyGenHMACMD5(secret, namespace []byte) []byte {
 	mac := hmac.New(md5.New, secret)
 	mac.Write(namespace)
 	return mac.Sum(nil)
 }
 
+func keyGenHKDF(secret, namespace []byte, size int) ([]byte, error) {
+	key := make([]byte, size)
+	r := hkdf.New(sha256.New, secret, namespace, []byte(hkdfInfo))
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// fpeInfo is the HKDF info label that derives the key of the Feistel
+// network used by WithValidUUIDs from the derived key, so that it never
+// shares a key with ECB mode for the same secret and namespace.
+const fpeInfo = "uuidcrypt fpe"
+
+func fpeKey(key []byte) ([]byte, error) {
+	fpe := make([]byte, len(key))
+	r := hkdf.New(sha256.New, key, nil, []byte(fpeInfo))
+	if _, err := io.ReadFull(r, fpe); err != nil {
+		return nil, err
+	}
+	return fpe, nil
+}
+
+// NewChainProcessor returns a Processor that runs each of the given
+// processors in order, passing the output of one to the next.
+//
+// Chaining a decrypting processor with an encrypting processor
+// re-encrypts data under new credentials without ever producing the
+// plaintext as output.
+func NewChainProcessor(processors ...Processor) Processor {
+	return chainProcessor(processors)
+}
+
+type chainProcessor []Processor
+
+func (c chainProcessor) Process(in []byte) []byte {
+	for _, p := range c {
+		in = p.Process(in)
+	}
+	return in
+}
+
+// processBatch runs each processor in the chain over the whole batch
+// in turn, keeping the errors of any of them, as ProcessBatch does.
+func (c chainProcessor) processBatch(dst, src []byte) []error {
+	if len(c) == 0 {
+		copy(dst, src)
+		return nil
+	}
+	errs := ProcessBatch(c[0], dst, src)
+	for _, p := range c[1:] {
+		errs = mergeBlockErrors(errs, ProcessBatch(p, dst[:len(src)], dst[:len(src)]))
+	}
+	return errs
+}
+
+// WithContext binds each processor in the chain that supports it to
+// the context. It panics if a key cannot be derived for the context.
+func (c chainProcessor) WithContext(context []byte) Processor {
+	bound, err := c.bindContext(context)
+	if err != nil {
+		panic(err)
+	}
+	return bound
+}
+
+func (c chainProcessor) bindContext(context []byte) (Processor, error) {
+	bound := make(chainProcessor, len(c))
+	for i, p := range c {
+		var err error
+		if bound[i], err = bindContext(p, context); err != nil {
+			return nil, err
+		}
+	}
+	return bound, nil
+}
+
+// contextBinder is implemented by the processors of this package,
+// which return an error rather than panic when a key cannot be
+// derived for a context.
+type contextBinder interface {
+	bindContext(context []byte) (Processor, error)
+}
+
+// bindContext binds p to the context if it supports one, or else
+// returns p as is.
+func bindContext(p Processor, context []byte) (Processor, error) {
+	switch cp := p.(type) {
+	case contextBinder:
+		return cp.bindContext(context)
+	case ContextProcessor:
+		return cp.WithContext(context), nil
+	}
+	return p, nil
+}
+
+// WithContext returns a processor whose key is derived from the
+// namespace followed by a zero byte and the context. The processors
+// of the most recently used contexts are cached. It panics if a key
+// cannot be derived for the context.
+func (p *crypterProcessor) WithContext(context []byte) Processor {
+	cp, err := p.bindContext(context)
+	if err != nil {
+		panic(err)
+	}
+	return cp
+}
+
+func (p *crypterProcessor) bindContext(context []byte) (Processor, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cp, ok := p.contexts.get(context); ok {
+		return cp, nil
+	}
+	cp, err := newCrypterProcessor(p.secret, contextNamespace(p.namespace, context), p.cryptType, p.options...)
+	if err != nil {
+		return nil, err
+	}
+	p.contexts.add(context, cp)
+	return cp, nil
+}
+
+// maxContexts is the number of context processors a crypterProcessor
+// caches, so that a context column with many distinct values does not
+// use unbounded memory. Evicted processors are derived again when
+// their context is next used.
+const maxContexts = 1024
+
+// contextCache caches processors by context, evicting the least
+// recently used.
+type contextCache struct {
+	entries map[string]*list.Element
+	order   list.List // of *contextEntry, most recently used first
+}
+
+type contextEntry struct {
+	context   string
+	processor Processor
+}
+
+func (c *contextCache) get(context []byte) (Processor, bool) {
+	e, ok := c.entries[string(context)]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*contextEntry).processor, true
+}
+
+func (c *contextCache) add(context []byte, processor Processor) {
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	c.entries[string(context)] = c.order.PushFront(&contextEntry{context: string(context), processor: processor})
+	if c.order.Len() > maxContexts {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*contextEntry).context)
+	}
+}
+
+func contextNamespace(namespace, context []byte) []byte {
+	b := make([]byte, 0, len(namespace)+1+len(context))
+	b = append(b, namespace...)
+	b = append(b, 0)
+	return append(b, context...)
+}
+
 func (p *crypterProcessor) Process(in []byte) []byte {
 	switch p.cryptType {
 	case EncryptType:
@@ -66,6 +479,17 @@ func (p *crypterProcessor) Process(in []byte) []byte {
 	return in
 }
 
+func (p *crypterProcessor) ProcessBatch(dst, src []byte) {
+	switch p.cryptType {
+	case EncryptType:
+		p.cipher.EncryptBlocks(dst, src)
+	case DecryptType:
+		p.cipher.DecryptBlocks(dst, src)
+	default:
+		copy(dst, src)
+	}
+}
+
 func (p *crypterProcessor) encrypt(in []byte) []byte {
 	return p.cipher.Encrypt(in)
 }
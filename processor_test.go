@@ -0,0 +1,203 @@
+package uuidcrypt
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var testBlock = []byte("0123456789abcdef")
+
+func TestKeyGenV1MatchesLegacy(t *testing.T) {
+	mac := hmac.New(md5.New, []byte(testSecret))
+	mac.Write([]byte(testNamespace))
+	key, err := keyGen(KDFv1, []byte(testSecret), []byte(testNamespace), 16)
+	failIfError(t, err)
+	assert(t, bytes.Equal(key, mac.Sum(nil)), "v1 key should be the HMAC-MD5 of the namespace")
+}
+
+func TestKeyGenV2(t *testing.T) {
+	v1, err := keyGen(KDFv1, []byte(testSecret), []byte(testNamespace), 16)
+	failIfError(t, err)
+	v2, err := keyGen(KDFv2, []byte(testSecret), []byte(testNamespace), 16)
+	failIfError(t, err)
+	other, err := keyGen(KDFv2, []byte(testSecret), []byte("other"), 16)
+	failIfError(t, err)
+	assert(t, len(v2) == 16, fmt.Sprintf("v2 key should be 16 bytes: %d", len(v2)))
+	assert(t, !bytes.Equal(v1, v2), "v2 key should differ from v1 key")
+	assert(t, !bytes.Equal(v2, other), "v2 key should depend on the namespace")
+}
+
+// TestKDFv2KnownAnswer pins the HKDF-SHA256 keys and ciphertexts of
+// KDFv2, so that changes to its salt or info label cannot silently
+// break existing data.
+func TestKDFv2KnownAnswer(t *testing.T) {
+	in := uuid.MustParse(testUUID)
+	for _, tt := range []struct {
+		bits       int
+		key        string
+		ciphertext string
+	}{
+		{128, "c2d1df7d42184d0bcf16e2894f3c390f", "ea53a82b-0bec-5a41-a05f-1e67b0d4b826"},
+		{256, "c2d1df7d42184d0bcf16e2894f3c390fc9fe3060a02ef03d685d9b50e383fa6c", "504e4a0b-e881-f548-40d8-9457a78b0b6d"},
+	} {
+		key, err := keyGen(KDFv2, []byte(testSecret), []byte(testNamespace), tt.bits/8)
+		failIfError(t, err)
+		assert(t, hex.EncodeToString(key) == tt.key, fmt.Sprintf("unexpected %d-bit key: %x", tt.bits, key))
+		enc := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType, WithKDF(KDFv2), WithKeySize(tt.bits))
+		out := ProcessUUID(enc, in)
+		assert(t, out.String() == tt.ciphertext, fmt.Sprintf("unexpected %d-bit ciphertext: %s", tt.bits, out))
+	}
+}
+
+func TestCrypterProcessorV2RoundTrip(t *testing.T) {
+	enc := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType, WithKDF(KDFv2))
+	dec := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), DecryptType, WithKDF(KDFv2))
+	ciphertext := enc.Process(testBlock)
+	assert(t, !bytes.Equal(ciphertext, testBlock), "ciphertext should not match plaintext")
+	assert(t, bytes.Equal(dec.Process(ciphertext), testBlock), "decrypted text should match plaintext")
+}
+
+func TestParseKDFVersion(t *testing.T) {
+	for str, expected := range map[string]KDFVersion{"": KDFv1, "v1": KDFv1, "v2": KDFv2} {
+		kdf, err := ParseKDFVersion(str)
+		failIfError(t, err)
+		assert(t, kdf == expected, fmt.Sprintf("%q should parse to %d: %d", str, expected, kdf))
+	}
+	_, err := ParseKDFVersion("v3")
+	assert(t, err == ErrUnknownKDF, fmt.Sprintf("should encounter error: %v", ErrUnknownKDF))
+}
+
+func TestCrypterProcessorKeySizes(t *testing.T) {
+	var ciphertexts [][]byte
+	for _, bits := range []int{128, 192, 256} {
+		enc := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType, WithKDF(KDFv2), WithKeySize(bits))
+		dec := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), DecryptType, WithKDF(KDFv2), WithKeySize(bits))
+		assert(t, len(enc.(*crypterProcessor).key) == bits/8, fmt.Sprintf("key should be %d bits", bits))
+		ciphertext := enc.Process(testBlock)
+		assert(t, bytes.Equal(dec.Process(ciphertext), testBlock), "decrypted text should match plaintext")
+		for _, other := range ciphertexts {
+			assert(t, !bytes.Equal(ciphertext, other), "key sizes should produce different ciphertext")
+		}
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+}
+
+func TestValidateKeySize(t *testing.T) {
+	failIfError(t, ValidateKeySize(KDFv1, 128))
+	failIfError(t, ValidateKeySize(KDFv2, 256))
+	assert(t, ValidateKeySize(KDFv1, 256) == ErrUnsupportedKeySize, "v1 should not support 256-bit keys")
+	assert(t, ValidateKeySize(KDFv2, 64) == ErrUnsupportedKeySize, "64-bit keys should not be supported")
+}
+
+// processorFunc is a Processor that is not a BatchProcessor.
+type processorFunc func([]byte) []byte
+
+func (f processorFunc) Process(in []byte) []byte {
+	return f(in)
+}
+
+func TestProcessBatch(t *testing.T) {
+	src := bytes.Repeat(testBlock, 8)
+	for i := range src {
+		src[i] += byte(i)
+	}
+	ecb := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType)
+	fpe := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType, WithValidUUIDs())
+	for _, p := range []Processor{
+		ecb,
+		fpe,
+		NewChainProcessor(ecb, fpe),
+		NewChainProcessor(processorFunc(ecb.Process), fpe),
+	} {
+		dst := make([]byte, len(src))
+		ProcessBatch(p, dst, src)
+		for i := 0; i < len(src); i += 16 {
+			assert(t, bytes.Equal(dst[i:i+16], p.Process(src[i:i+16])), fmt.Sprintf("block %d should match Process", i/16))
+		}
+		inPlace := append([]byte(nil), src...)
+		ProcessBatch(p, inPlace, inPlace)
+		assert(t, bytes.Equal(inPlace, dst), "processing in place should match")
+	}
+
+	short := processorFunc(func(in []byte) []byte { return in[:8] })
+	errs := ProcessBatch(NewChainProcessor(short, ecb), make([]byte, len(src)), src)
+	assert(t, len(errs) == len(src)/16, fmt.Sprintf("there should be an error per block: %v", errs))
+	for _, err := range errs {
+		assert(t, errors.Is(err, ErrBadProcessorOutput), fmt.Sprintf("short output should be an error: %v", err))
+	}
+}
+
+func benchmarkBlocks(n int) []byte {
+	src := make([]byte, n*16)
+	for i := range src {
+		src[i] = byte(i)
+	}
+	return src
+}
+
+func BenchmarkProcess(b *testing.B) {
+	p := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType)
+	src := benchmarkBlocks(batchSize)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(src); j += 16 {
+			p.Process(src[j : j+16])
+		}
+	}
+}
+
+func BenchmarkProcessBatch(b *testing.B) {
+	p := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType)
+	src := benchmarkBlocks(batchSize)
+	dst := make([]byte, len(src))
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ProcessBatch(p, dst, src)
+	}
+}
+
+func TestContextCache(t *testing.T) {
+	p := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType).(*crypterProcessor)
+	first := p.WithContext([]byte("tenant-0")).Process(testBlock)
+	for i := 1; i <= maxContexts; i++ {
+		p.WithContext([]byte(fmt.Sprintf("tenant-%d", i)))
+	}
+	assert(t, len(p.contexts.entries) == maxContexts, fmt.Sprintf("cache should be bounded: %d", len(p.contexts.entries)))
+	_, ok := p.contexts.get([]byte("tenant-0"))
+	assert(t, !ok, "least recently used context should be evicted")
+	assert(t, bytes.Equal(p.WithContext([]byte("tenant-0")).Process(testBlock), first), "evicted contexts should be derived again")
+
+	bad := &crypterProcessor{secret: []byte(testSecret), cryptType: EncryptType, options: []ProcessorOptions{WithKeySize(100)}}
+	_, err := bad.bindContext([]byte("tenant"))
+	assert(t, errors.Is(err, ErrUnsupportedKeySize), fmt.Sprintf("key derivation errors should be returned: %v", err))
+	err = NewUUIDCrypt(&memFile{rows: [][]string{{"id", "tenant"}, {testUUID, "tenant"}}}, &memFile{}, bad, WithContextColumn(2)).Run()
+	var e *Error
+	assert(t, errors.As(err, &e) && e.Kind == CryptoError && errors.Is(err, ErrContextKey), fmt.Sprintf("should be a crypto error: %v", err))
+}
+
+// TestContextKnownAnswer pins the ciphertext of a context-bound
+// processor, whose key is derived from the namespace, a zero byte and
+// the context.
+func TestContextKnownAnswer(t *testing.T) {
+	in := uuid.MustParse(testUUID)
+	for _, tt := range []struct {
+		kdf      KDFVersion
+		expected string
+	}{
+		{KDFv1, "d3858aa4-1000-8014-761a-e54553d3c493"},
+		{KDFv2, "4685ed71-f5dd-2091-1156-060c7633750f"},
+	} {
+		p := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType, WithKDF(tt.kdf)).(ContextProcessor)
+		out := ProcessUUID(p.WithContext([]byte("tenant-a")), in)
+		assert(t, out.String() == tt.expected, fmt.Sprintf("unexpected ciphertext with kdf %d: %s", tt.kdf, out))
+	}
+}
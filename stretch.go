@@ -0,0 +1,162 @@
+package uuidcrypt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrUnknownStretch       = errors.New("stretch: unknown stretching algorithm")
+	ErrInvalidStretchParams = errors.New("stretch: invalid parameters")
+)
+
+// StretchAlgorithm is a passphrase stretching algorithm, which makes
+// it expensive to brute-force a human-chosen secret.
+type StretchAlgorithm int
+
+const (
+	// ScryptStretch stretches the secret with scrypt.
+	ScryptStretch StretchAlgorithm = 1 + iota
+
+	// Argon2idStretch stretches the secret with Argon2id.
+	Argon2idStretch
+)
+
+// stretchedSize is the size in bytes of a stretched secret.
+const stretchedSize = 32
+
+// Stretch describes how a secret is stretched before keys are derived
+// from it. The zero value does not stretch the secret.
+type Stretch struct {
+	Algorithm StretchAlgorithm
+
+	// Salt is the salt to stretch the secret with. The namespace is
+	// used if it is empty.
+	Salt []byte
+
+	// N, R and P are the CPU/memory cost, block size and
+	// parallelization parameters of scrypt. N must be a power of two
+	// greater than 1.
+	N, R, P int
+
+	// Time, Memory and Threads are the number of passes, the memory
+	// in KiB and the degree of parallelism of Argon2id.
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// DefaultScrypt returns the recommended scrypt parameters:
+// N=32768, r=8, p=1.
+func DefaultScrypt() Stretch {
+	return Stretch{Algorithm: ScryptStretch, N: 1 << 15, R: 8, P: 1}
+}
+
+// DefaultArgon2id returns the parameters recommended by RFC 9106 for
+// memory-constrained environments: t=3, m=65536 (64 MiB), p=4.
+func DefaultArgon2id() Stretch {
+	return Stretch{Algorithm: Argon2idStretch, Time: 3, Memory: 64 * 1024, Threads: 4}
+}
+
+// ParseStretch returns the Stretch for algorithm, "scrypt" or
+// "argon2id", with the default parameters overridden by params, a
+// comma-separated list such as "N=65536,r=8,p=1" for scrypt or
+// "t=3,m=65536,p=4" for Argon2id. An empty algorithm or "none" means
+// no stretching.
+func ParseStretch(algorithm, params string) (Stretch, error) {
+	var s Stretch
+	switch algorithm {
+	case "", "none":
+		if params != "" {
+			return Stretch{}, fmt.Errorf("%w: %q without an algorithm", ErrInvalidStretchParams, params)
+		}
+		return s, nil
+	case "scrypt":
+		s = DefaultScrypt()
+	case "argon2id":
+		s = DefaultArgon2id()
+	default:
+		return Stretch{}, fmt.Errorf("%w: %q", ErrUnknownStretch, algorithm)
+	}
+	for _, param := range strings.Split(params, ",") {
+		if param == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(param, "=")
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return Stretch{}, fmt.Errorf("%w: %q", ErrInvalidStretchParams, param)
+		}
+		switch {
+		case s.Algorithm == ScryptStretch && name == "N":
+			s.N = int(n)
+		case s.Algorithm == ScryptStretch && name == "r":
+			s.R = int(n)
+		case s.Algorithm == ScryptStretch && name == "p":
+			s.P = int(n)
+		case s.Algorithm == Argon2idStretch && name == "t":
+			s.Time = uint32(n)
+		case s.Algorithm == Argon2idStretch && name == "m":
+			s.Memory = uint32(n)
+		case s.Algorithm == Argon2idStretch && name == "p" && n <= 255:
+			s.Threads = uint8(n)
+		default:
+			return Stretch{}, fmt.Errorf("%w: %q", ErrInvalidStretchParams, param)
+		}
+	}
+	if err := ValidateStretch(s); err != nil {
+		return Stretch{}, err
+	}
+	return s, nil
+}
+
+// ValidateStretch returns an error if the parameters of s are not
+// supported by its algorithm.
+func ValidateStretch(s Stretch) error {
+	switch s.Algorithm {
+	case 0:
+		return nil
+	case ScryptStretch:
+		if s.N <= 1 || s.N&(s.N-1) != 0 || s.R < 1 || s.P < 1 || uint64(s.R)*uint64(s.P) >= 1<<30 {
+			return fmt.Errorf("%w: N=%d, r=%d, p=%d", ErrInvalidStretchParams, s.N, s.R, s.P)
+		}
+		return nil
+	case Argon2idStretch:
+		if s.Time < 1 || s.Threads < 1 || s.Memory < 8*uint32(s.Threads) {
+			return fmt.Errorf("%w: t=%d, m=%d, p=%d", ErrInvalidStretchParams, s.Time, s.Memory, s.Threads)
+		}
+		return nil
+	}
+	return ErrUnknownStretch
+}
+
+// stretch returns the stretched secret, salted with the namespace
+// unless an explicit salt is given. It returns the secret as is if s
+// is the zero value.
+func (s Stretch) stretch(secret, namespace []byte) ([]byte, error) {
+	if err := ValidateStretch(s); err != nil {
+		return nil, err
+	}
+	salt := s.Salt
+	if len(salt) == 0 {
+		salt = namespace
+	}
+	switch s.Algorithm {
+	case 0:
+		return secret, nil
+	case ScryptStretch:
+		key, err := scrypt.Key(secret, salt, s.N, s.R, s.P, stretchedSize)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidStretchParams, err)
+		}
+		return key, nil
+	case Argon2idStretch:
+		return argon2.IDKey(secret, salt, s.Time, s.Memory, s.Threads, stretchedSize), nil
+	}
+	return nil, ErrUnknownStretch
+}
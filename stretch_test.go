@@ -0,0 +1,93 @@
+package uuidcrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var (
+	testScrypt   = Stretch{Algorithm: ScryptStretch, N: 16, R: 8, P: 1}
+	testArgon2id = Stretch{Algorithm: Argon2idStretch, Time: 1, Memory: 64, Threads: 1}
+)
+
+func TestParseStretch(t *testing.T) {
+	s, err := ParseStretch("scrypt", "")
+	failIfError(t, err)
+	assert(t, s.Algorithm == ScryptStretch && s.N == 1<<15 && s.R == 8 && s.P == 1, "scrypt should use the default parameters")
+	s, err = ParseStretch("argon2id", "t=1,m=1024,p=2")
+	failIfError(t, err)
+	assert(t, s.Time == 1 && s.Memory == 1024 && s.Threads == 2, "argon2id parameters should be parsed")
+	s, err = ParseStretch("", "")
+	failIfError(t, err)
+	assert(t, s.Algorithm == 0, "no algorithm should mean no stretching")
+
+	for _, tt := range []struct{ algorithm, params string }{
+		{"bcrypt", ""},
+		{"scrypt", "t=1"},
+		{"argon2id", "p=256"},
+		{"scrypt", "N=x"},
+		{"none", "N=16"},
+	} {
+		_, err := ParseStretch(tt.algorithm, tt.params)
+		assert(t, errors.Is(err, ErrUnknownStretch) || errors.Is(err, ErrInvalidStretchParams), "expected an error for "+tt.algorithm+" "+tt.params)
+	}
+	_, err = NewCrypter([]byte(testSecret), []byte(testNamespace), WithStretch(Stretch{Algorithm: ScryptStretch, N: 3, R: 8, P: 1}))
+	assert(t, errors.Is(err, ErrInvalidStretchParams), "scrypt N should be a power of two")
+}
+
+func TestStretch(t *testing.T) {
+	plain := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType)
+	var outputs [][]byte
+	for _, stretch := range []Stretch{testScrypt, testArgon2id, {Algorithm: ScryptStretch, N: 16, R: 8, P: 1, Salt: []byte("salt")}} {
+		enc := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType, WithStretch(stretch))
+		dec := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), DecryptType, WithStretch(stretch))
+		ciphertext := enc.Process(testBlock)
+		assert(t, !bytes.Equal(ciphertext, plain.Process(testBlock)), "stretching should change the key")
+		assert(t, bytes.Equal(dec.Process(ciphertext), testBlock), "decrypted text should match plaintext")
+		for _, other := range outputs {
+			assert(t, !bytes.Equal(ciphertext, other), "each stretch should give a different key")
+		}
+		outputs = append(outputs, ciphertext)
+	}
+
+	// contexts are derived from the stretched secret, without stretching it again.
+	p, err := newCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType, WithStretch(testScrypt))
+	failIfError(t, err)
+	bound := p.WithContext([]byte("tenant"))
+	expected := NewCrypterProcessor(p.secret, contextNamespace([]byte(testNamespace), []byte("tenant")), EncryptType)
+	assert(t, bytes.Equal(bound.Process(testBlock), expected.Process(testBlock)), "context keys should be derived from the stretched secret")
+	assert(t, bound.(*crypterProcessor).stretch.Algorithm == 0, "context processors should not stretch again")
+
+	crypter, err := NewCrypter([]byte(testSecret), []byte(testNamespace), WithStretch(testArgon2id))
+	failIfError(t, err)
+	assert(t, bytes.Equal(crypter.encrypter.Process(testBlock), outputs[1]), "crypter should match the processor")
+	assert(t, bytes.Equal(crypter.decrypter.Process(outputs[1]), testBlock), "crypter should decrypt")
+}
+
+// TestStretchKnownAnswer pins the output of each stretching algorithm,
+// so that changes to how it is called cannot silently break existing
+// data. Without a salt, the namespace is the salt.
+func TestStretchKnownAnswer(t *testing.T) {
+	withSalt := func(s Stretch, salt string) Stretch {
+		s.Salt = []byte(salt)
+		return s
+	}
+	for _, tt := range []struct {
+		stretch  Stretch
+		expected string
+	}{
+		{testScrypt, "bf6004ec3f1f33cd3f4733e7f3128839e455a8680dfe30da31e75a14ed8c7a4a"},
+		{withSalt(testScrypt, testNamespace), "bf6004ec3f1f33cd3f4733e7f3128839e455a8680dfe30da31e75a14ed8c7a4a"},
+		{withSalt(testScrypt, "salt"), "46cce1189883915ce424f3b556591cf71fee9fdf0043729ed5fadb13e22ff6f4"},
+		{testArgon2id, "4cd420769dbc307d10fdee0e762aeb3c4f1ed0b5b1046dfde20991792e898130"},
+		{withSalt(testArgon2id, testNamespace), "4cd420769dbc307d10fdee0e762aeb3c4f1ed0b5b1046dfde20991792e898130"},
+		{withSalt(testArgon2id, "salt"), "8ecc4385913a9153be6c75d02a44b20974a7e342ec7e49aa92f8db188186da88"},
+	} {
+		out, err := tt.stretch.stretch([]byte(testSecret), []byte(testNamespace))
+		failIfError(t, err)
+		assert(t, hex.EncodeToString(out) == tt.expected, fmt.Sprintf("unexpected output for %+v: %x", tt.stretch, out))
+	}
+}
@@ -0,0 +1,130 @@
+package uuidcrypt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+)
+
+// uuidPattern matches UUID-shaped tokens in the canonical
+// 8-4-4-4-12 hex form.
+var uuidPattern = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// TextOptions are optional parameters that can be provided to
+// NewTextCrypt to inform its configuration when it runs.
+type TextOptions func(*textCrypt)
+
+// WithTextUUIDFormat specifies how processed UUIDs are written. With
+// CanonicalFormat, uppercase UUIDs are written in lowercase, so the
+// original input can no longer be restored byte for byte.
+// PreserveFormat is used if no format is specified.
+func WithTextUUIDFormat(format UUIDFormat) TextOptions {
+	return func(t *textCrypt) {
+		t.format = format
+	}
+}
+
+// NewTextCrypt returns a UUIDCrypt object that treats input as plain
+// text, such as a log file, and replaces every UUID-shaped token with
+// its processed value. All other bytes are copied as is, so that the
+// reverse operation restores the original input byte for byte.
+//
+// A token is only replaced if it is not directly preceded or followed
+// by a letter or a digit, and if its letters are either all lowercase
+// or all uppercase; the case is kept in the output. Tokens in mixed
+// case are left untouched, since their case could not be restored.
+func NewTextCrypt(input io.Reader, output io.Writer, processor Processor, options ...TextOptions) UUIDCrypt {
+	t := &textCrypt{
+		r:         bufio.NewReader(input),
+		w:         bufio.NewWriter(output),
+		file:      fileName(input),
+		processor: processor,
+		format:    PreserveFormat,
+	}
+	for _, opt := range options {
+		opt(t)
+	}
+	return t
+}
+
+type textCrypt struct {
+	r         *bufio.Reader
+	w         *bufio.Writer
+	file      string
+	processor Processor
+	format    UUIDFormat
+	line      int
+}
+
+func (t *textCrypt) Run() error {
+	for {
+		line, err := t.r.ReadBytes('\n')
+		if len(line) > 0 {
+			t.line++
+			if err := t.processLine(line); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &Error{Kind: IOError, File: t.file, Line: t.line + 1, Err: err}
+		}
+	}
+	if err := t.w.Flush(); err != nil {
+		return &Error{Kind: IOError, Err: err}
+	}
+	return nil
+}
+
+func (t *textCrypt) processLine(line []byte) error {
+	start := 0
+	for _, loc := range uuidPattern.FindAllIndex(line, -1) {
+		token := line[loc[0]:loc[1]]
+		if mixedCase(token) || isAlphanumeric(line, loc[0]-1) || isAlphanumeric(line, loc[1]) {
+			continue
+		}
+		value, err := processUUIDString(t.processor, string(token), t.format)
+		if err != nil {
+			kind := ParseError
+			if errors.Is(err, ErrBadProcessorOutput) {
+				kind = CryptoError
+			}
+			return &Error{Kind: kind, File: t.file, Line: t.line, Column: loc[0] + 1, Err: err}
+		}
+		if err := t.write(line[start:loc[0]]); err != nil {
+			return err
+		}
+		if err := t.write([]byte(value)); err != nil {
+			return err
+		}
+		start = loc[1]
+	}
+	return t.write(line[start:])
+}
+
+func (t *textCrypt) write(b []byte) error {
+	if _, err := t.w.Write(b); err != nil {
+		return &Error{Kind: IOError, Err: err}
+	}
+	return nil
+}
+
+// mixedCase reports whether token has both lowercase and uppercase
+// letters.
+func mixedCase(token []byte) bool {
+	return bytes.ContainsAny(token, "abcdef") && bytes.ContainsAny(token, "ABCDEF")
+}
+
+// isAlphanumeric reports whether line[i] is an ASCII letter or digit.
+// It is false if i is out of range.
+func isAlphanumeric(line []byte, i int) bool {
+	if i < 0 || i >= len(line) {
+		return false
+	}
+	c := line[i]
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
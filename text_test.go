@@ -0,0 +1,42 @@
+package uuidcrypt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func runTextCrypt(t *testing.T, input string, processor Processor) string {
+	var output bytes.Buffer
+	err := NewTextCrypt(strings.NewReader(input), &output, processor).Run()
+	failIfError(t, err)
+	return output.String()
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	upper := strings.ToUpper(testUUID2)
+	input := "2024-01-01T00:00:00Z INFO user=" + testUUID + " req-" + upper + ": ok\r\n" +
+		"\n" +
+		"[" + testUUID + "," + testUUID2 + "]\t\xff no newline"
+	encrypted := runTextCrypt(t, input, newTestProcessor(testNamespace, EncryptType))
+	assert(t, !strings.Contains(encrypted, testUUID) && !strings.Contains(encrypted, upper), "every uuid should be encrypted: "+encrypted)
+	assert(t, strings.HasPrefix(encrypted, "2024-01-01T00:00:00Z INFO user="), "surrounding text should be preserved")
+	i := strings.Index(encrypted, "req-") + 4
+	assert(t, encrypted[i:i+36] == strings.ToUpper(encrypted[i:i+36]), "uppercase uuids should stay uppercase")
+
+	decrypted := runTextCrypt(t, encrypted, newTestProcessor(testNamespace, DecryptType))
+	assert(t, decrypted == input, "decrypted output should match input: "+decrypted)
+}
+
+func TestTextSkipsTokens(t *testing.T) {
+	for _, input := range []string{
+		"x" + testUUID,
+		testUUID + "0",
+		"4A1981ca-94af-481d-8266-58d86cc8199a",
+		"4a1981ca-94af-481d-8266-58d86cc8199",
+		"4a1981ca94af481d826658d86cc8199a",
+	} {
+		output := runTextCrypt(t, input, newTestProcessor(testNamespace, EncryptType))
+		assert(t, output == input, "token should be left untouched: "+input)
+	}
+}
@@ -1,14 +1,31 @@
-package main
+// Package uuidcrypt implements two-way format-preserving encryption of
+// UUIDs, both of individual values and of the UUIDs in CSV files.
+package uuidcrypt
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"strconv"
+)
 
-	"github.com/google/uuid"
+var (
+	ErrContextColumnProcessed = errors.New("uuidcrypt: context column cannot be processed")
+	ErrContextUnsupported     = errors.New("uuidcrypt: processor does not support a context")
+	ErrMissingContext         = errors.New("uuidcrypt: row has no context column")
+	ErrContextKey             = errors.New("uuidcrypt: cannot derive a key for the context")
+	ErrHeaderRequired         = errors.New("uuidcrypt: column names require a header")
+	ErrUnknownColumn          = errors.New("uuidcrypt: unknown column")
+	ErrRejectFileRequired     = errors.New("uuidcrypt: reject-file policy requires a reject file")
+	ErrBadProcessorOutput     = errors.New("uuidcrypt: processor output is not a uuid")
 )
 
 // UUIDCrypt parses an input csv file, processes it, and produces an
 // output csv file. It is meant to be used with a NewCrypterProcessor
 // to encrypt UUIDs within the file in a reversible manner.
+//
+// Errors returned by Run are *Error values that classify the failure
+// and, where known, record the file, line and column it occurred at.
 type UUIDCrypt interface {
 	Run() error
 }
@@ -26,6 +43,105 @@ func WithColumns(columns ...int) UUIDCryptOptions {
 	}
 }
 
+// WithColumnNames specifies columns to process by their name in the
+// header row. It requires WithHeader.
+func WithColumnNames(names ...string) UUIDCryptOptions {
+	return func(u *uuidCrypt) {
+		u.columnNames = append(u.columnNames, names...)
+	}
+}
+
+// WithHeader specifies that the first row of the CSV is a header. It
+// is passed through untouched and used to resolve column names.
+//
+// Without a header, a first row that cannot be processed is assumed
+// to be a header and passed through untouched.
+func WithHeader() UUIDCryptOptions {
+	return func(u *uuidCrypt) {
+		u.header = true
+	}
+}
+
+// WithColumnProcessor uses processor, instead of the default processor,
+// for the given column. The column must also be one of the columns
+// to process, see WithColumns.
+//
+// It allows columns to be encrypted under different namespaces so
+// that their values cannot be correlated with each other.
+func WithColumnProcessor(column int, processor Processor) UUIDCryptOptions {
+	return func(u *uuidCrypt) {
+		u.columnProcessors[column] = processor
+	}
+}
+
+// WithNamedColumnProcessor is like WithColumnProcessor, but for a
+// column specified by its name in the header row.
+func WithNamedColumnProcessor(name string, processor Processor) UUIDCryptOptions {
+	return func(u *uuidCrypt) {
+		u.namedProcessors[name] = processor
+	}
+}
+
+// WithContextColumn binds the processing of each row to the value of
+// the given column, such as a tenant ID, so that the same UUID is
+// transformed differently in rows with different contexts. Processors
+// must implement ContextProcessor, and the context column must not be
+// one of the columns to process.
+func WithContextColumn(column int) UUIDCryptOptions {
+	return func(u *uuidCrypt) {
+		u.contextColumn = column
+	}
+}
+
+// WithContextColumnName is like WithContextColumn, but for a column
+// specified by its name in the header row.
+func WithContextColumnName(name string) UUIDCryptOptions {
+	return func(u *uuidCrypt) {
+		u.contextColumnName = name
+	}
+}
+
+// WithRowErrorPolicy specifies what to do with rows containing values
+// that cannot be processed. RowErrorStrict is used if no policy is
+// specified.
+//
+// Regardless of the policy, a first row that cannot be processed is
+// assumed to be a header and passed through untouched, unless
+// WithHeader is used.
+func WithRowErrorPolicy(policy RowErrorPolicy) UUIDCryptOptions {
+	return func(u *uuidCrypt) {
+		u.policy = policy
+	}
+}
+
+// WithRejectFile specifies where RowErrorRejectFile writes rejected
+// rows. Each row is prefixed with the line number it began on in the
+// input.
+func WithRejectFile(reject File) UUIDCryptOptions {
+	return func(u *uuidCrypt) {
+		u.reject = reject
+	}
+}
+
+// WithUUIDFormat specifies how processed UUIDs are written.
+// PreserveFormat is used if no format is specified.
+func WithUUIDFormat(format UUIDFormat) UUIDCryptOptions {
+	return func(u *uuidCrypt) {
+		u.format = format
+	}
+}
+
+// WithWorkers processes rows across the given number of goroutines,
+// while still writing them in their original order. Processors must be
+// safe for concurrent use, as those returned by NewCrypterProcessor
+// are. Rows are processed one at a time if workers is less than 2, the
+// default.
+func WithWorkers(workers int) UUIDCryptOptions {
+	return func(u *uuidCrypt) {
+		u.workers = workers
+	}
+}
+
 // NewUUIDCrypt returns a UUIDCrypt object for encrypting the UUIDs
 // of an input csv file and producing an output csv file.
 func NewUUIDCrypt(
@@ -35,98 +151,382 @@ func NewUUIDCrypt(
 	options ...UUIDCryptOptions,
 ) UUIDCrypt {
 	u := &uuidCrypt{
-		input:       input,
-		output:      output,
-		processor:   processor,
-		columns:     []int{1},
-		headerError: false,
+		input:            input,
+		output:           output,
+		processor:        processor,
+		columnProcessors: make(map[int]Processor),
+		namedProcessors:  make(map[string]Processor),
+		policy:           RowErrorStrict,
+		format:           PreserveFormat,
+		headerError:      false,
 	}
 	for _, opt := range options {
 		opt(u)
 	}
+	if len(u.columns) == 0 && len(u.columnNames) == 0 {
+		u.columns = []int{1}
+	}
 	return u
 }
 
 type uuidCrypt struct {
-	input       File
-	output      File
-	processor   Processor
-	columns     []int
-	headerError bool
+	input             File
+	output            File
+	processor         Processor
+	columnProcessors  map[int]Processor
+	columns           []int
+	columnNames       []string
+	namedProcessors   map[string]Processor
+	contextColumn     int
+	contextColumnName string
+	header            bool
+	headerError       bool
+	policy            RowErrorPolicy
+	reject            File
+	format            UUIDFormat
+	workers           int
+	numRows           int
 }
 
-func (u *uuidCrypt) Run() error {
+func (u *uuidCrypt) Run() (err error) {
 	defer u.input.Close()
-	defer u.output.Close()
-	for {
+	defer u.closeOutput(u.output, &err)
+	if u.reject != nil {
+		defer u.closeOutput(u.reject, &err)
+	}
+	if err := u.readHeader(); err != nil {
+		return errIfNotEOF(err)
+	}
+	if err := u.validate(); err != nil {
+		return withKind(ConfigError, err)
+	}
+	// the first row is always processed on its own, as it may be a
+	// header.
+	if !u.headerError {
 		if err := u.runOnce(); err != nil {
 			return errIfNotEOF(err)
 		}
 	}
-	return nil
+	if u.workers > 1 {
+		return errIfNotEOF(u.runParallel())
+	}
+	return errIfNotEOF(u.runBatches())
 }
 
 func (u *uuidCrypt) runOnce() error {
-	record, err := u.input.Read()
+	record, err := u.read()
 	if err != nil {
 		return err
 	}
-	var rowErr error
+	cells := u.processRecord(record)
+	if rowErr := firstCellError(cells); rowErr != nil && !u.headerError {
+		// assume the first row is a header, and pass it through.
+		u.headerError = true
+		return u.write(u.output, record)
+	}
+	u.headerError = true
+	return u.writeRecord(u.line(), record, cells)
+}
+
+func (u *uuidCrypt) read() ([]string, error) {
+	record, err := u.input.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, &Error{Kind: readErrorKind(err), File: fileName(u.input), Line: u.line(), Err: err}
+	}
+	u.numRows++
+	return record, nil
+}
+
+func (u *uuidCrypt) write(f File, record []string) error {
+	if err := f.Write(record); err != nil {
+		return &Error{Kind: IOError, File: fileName(f), Err: err}
+	}
+	return nil
+}
+
+// closeOutput closes f, reporting a failure to close as the error of
+// Run if there is not already one.
+func (u *uuidCrypt) closeOutput(f File, err *error) {
+	if closeErr := f.Close(); closeErr != nil && *err == nil {
+		*err = &Error{Kind: IOError, File: fileName(f), Err: closeErr}
+	}
+}
+
+// rowError returns the error for a cell that could not be processed.
+func (u *uuidCrypt) rowError(line int, c cell) error {
+	kind := ParseError
+	if errors.Is(c.err, ErrBadProcessorOutput) || errors.Is(c.err, ErrContextKey) {
+		kind = CryptoError
+	}
+	return &Error{Kind: kind, File: fileName(u.input), Line: line, Column: c.col + 1, Err: c.err}
+}
+
+// cell is the result of processing one column of a record.
+type cell struct {
+	col   int
+	value string
+	err   error
+}
+
+// processRecord processes the UUIDs in the columns of the record,
+// without modifying it.
+func (u *uuidCrypt) processRecord(record []string) []cell {
+	cells := make([]cell, 0, len(u.columns))
 	for _, column := range u.columns {
 		col := column - 1
 		if col > len(record)-1 || col < 0 {
 			continue
 		}
-		newUUID, err := u.processUUID(record[col])
-		if err != nil {
-			rowErr = err
+		c := cell{col: col}
+		if processor, err := u.rowProcessorFor(column, record); err != nil {
+			c.err = err
+		} else {
+			c.value, c.err = processUUIDString(processor, record[col], u.format)
+		}
+		cells = append(cells, c)
+	}
+	return cells
+}
+
+// processRecords is like processRecord for many records at once. Each
+// column is processed with a single call to ProcessBatch, unless rows
+// are bound to a context and so each need their own processor. The
+// processed UUIDs of a column are formatted into a single buffer, so
+// the allocations do not grow with the number of records.
+func (u *uuidCrypt) processRecords(records [][]string) [][]cell {
+	cells := make([][]cell, len(records))
+	if u.contextColumn != 0 {
+		for i, record := range records {
+			cells[i] = u.processRecord(record)
+		}
+		return cells
+	}
+	type pending struct {
+		row, cell, end int
+	}
+	rowCells := make([]cell, 0, len(records)*len(u.columns))
+	for i := range cells {
+		cells[i] = rowCells[i*len(u.columns) : i*len(u.columns) : (i+1)*len(u.columns)]
+	}
+	buf := make([]byte, 0, len(records)*uuidSize)
+	out := make([]byte, 0, len(records)*maxUUIDLength)
+	queue := make([]pending, 0, len(records))
+	for _, column := range u.columns {
+		col := column - 1
+		buf, queue = buf[:0], queue[:0]
+		for i, record := range records {
+			if col > len(record)-1 || col < 0 {
+				continue
+			}
+			n := len(buf)
+			buf = buf[:n+uuidSize]
+			err := parseUUID(buf[n:], record[col])
+			cells[i] = append(cells[i], cell{col: col, err: err})
+			if err != nil {
+				buf = buf[:n]
+			} else {
+				queue = append(queue, pending{row: i, cell: len(cells[i]) - 1})
+			}
+		}
+		errs := ProcessBatch(u.processorFor(column), buf, buf)
+		out = out[:0]
+		for k := range queue {
+			if errs == nil || errs[k] == nil {
+				out = u.format.appendFormat(out, buf[k*uuidSize:(k+1)*uuidSize], records[queue[k].row][col])
+			}
+			queue[k].end = len(out)
+		}
+		formatted, start := string(out), 0
+		for k, p := range queue {
+			c := &cells[p.row][p.cell]
+			if errs != nil && errs[k] != nil {
+				c.err = errs[k]
+			} else {
+				c.value = formatted[start:p.end]
+			}
+			start = p.end
+		}
+	}
+	return cells
+}
+
+// writeRecord writes the processed record to the output, handling
+// cells that could not be processed according to the row error
+// policy.
+func (u *uuidCrypt) writeRecord(line int, record []string, cells []cell) error {
+	for _, c := range cells {
+		if c.err == nil {
 			continue
 		}
-		record[col] = newUUID
+		switch u.policy {
+		case RowErrorSkipRow:
+			return nil
+		case RowErrorRejectFile:
+			return u.write(u.reject, append([]string{strconv.Itoa(line)}, record...))
+		case RowErrorPassthrough, RowErrorBlank:
+		default:
+			return u.rowError(line, c)
+		}
 	}
-	if rowErr != nil {
-		if u.headerError {
-			return rowErr
+	for _, c := range cells {
+		if c.err == nil {
+			record[c.col] = c.value
+		} else if u.policy == RowErrorBlank {
+			record[c.col] = ""
 		}
-		u.headerError = true
 	}
-	if err := u.output.Write(record); err != nil {
-		return err
+	return u.write(u.output, record)
+}
+
+func firstCellError(cells []cell) error {
+	for _, c := range cells {
+		if c.err != nil {
+			return c.err
+		}
 	}
 	return nil
 }
 
-func (u *uuidCrypt) processUUID(preUUID string) (string, error) {
-	preProc, err := uuidToBytes(preUUID)
-	if err != nil {
-		return "", err
+// line returns the line on which the last record read began, if the
+// input keeps track of it, or else the number of records read.
+func (u *uuidCrypt) line() int {
+	if l, ok := u.input.(LineTracker); ok {
+		return l.Line()
+	}
+	return u.numRows
+}
+
+// readHeader passes the header row through untouched, and resolves
+// column names against it.
+func (u *uuidCrypt) readHeader() error {
+	if !u.header {
+		if len(u.columnNames) > 0 || len(u.namedProcessors) > 0 || u.contextColumnName != "" {
+			return withKind(ConfigError, ErrHeaderRequired)
+		}
+		return nil
 	}
-	postProc := u.processor.Process(preProc)
-	postUUID, err := uuidFromBytes(postProc)
+	// a bad row after the header is always an error.
+	u.headerError = true
+	record, err := u.read()
 	if err != nil {
-		return "", err
+		return err
 	}
-	return postUUID, nil
+	if err := u.resolveColumnNames(record); err != nil {
+		return withKind(ConfigError, err)
+	}
+	return u.write(u.output, record)
 }
 
-func uuidToBytes(stringUUID string) ([]byte, error) {
-	u, err := uuid.Parse(stringUUID)
-	if err != nil {
-		return nil, err
+func (u *uuidCrypt) resolveColumnNames(header []string) error {
+	indexes := make(map[string]int, len(header))
+	for i, name := range header {
+		if _, ok := indexes[name]; !ok {
+			indexes[name] = i + 1
+		}
 	}
-	b, err := u.MarshalBinary()
+	columnIndex := func(name string) (int, error) {
+		if column, ok := indexes[name]; ok {
+			return column, nil
+		}
+		return 0, fmt.Errorf("%w: %s", ErrUnknownColumn, name)
+	}
+	for _, name := range u.columnNames {
+		column, err := columnIndex(name)
+		if err != nil {
+			return err
+		}
+		u.columns = append(u.columns, column)
+	}
+	for name, processor := range u.namedProcessors {
+		column, err := columnIndex(name)
+		if err != nil {
+			return err
+		}
+		u.columnProcessors[column] = processor
+	}
+	if u.contextColumnName != "" {
+		column, err := columnIndex(u.contextColumnName)
+		if err != nil {
+			return err
+		}
+		u.contextColumn = column
+	}
+	return nil
+}
+
+func (u *uuidCrypt) validate() error {
+	if u.policy == RowErrorRejectFile && u.reject == nil {
+		return ErrRejectFileRequired
+	}
+	if u.contextColumn == 0 {
+		return nil
+	}
+	for _, column := range u.columns {
+		if column == u.contextColumn {
+			return ErrContextColumnProcessed
+		}
+		if _, ok := u.processorFor(column).(ContextProcessor); !ok {
+			return ErrContextUnsupported
+		}
+	}
+	return nil
+}
+
+// rowProcessorFor returns the processor for a column of the record,
+// bound to the record's context if there is a context column.
+func (u *uuidCrypt) rowProcessorFor(column int, record []string) (Processor, error) {
+	processor := u.processorFor(column)
+	if u.contextColumn == 0 {
+		return processor, nil
+	}
+	col := u.contextColumn - 1
+	if col > len(record)-1 || col < 0 {
+		return nil, ErrMissingContext
+	}
+	bound, err := bindContext(processor, []byte(record[col]))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrContextKey, err)
 	}
-	return b, nil
+	return bound, nil
 }
 
-func uuidFromBytes(bytes []byte) (string, error) {
-	u := new(uuid.UUID)
-	if err := u.UnmarshalBinary(bytes); err != nil {
+func (u *uuidCrypt) processorFor(column int) Processor {
+	if p, ok := u.columnProcessors[column]; ok {
+		return p
+	}
+	return u.processor
+}
+
+// processUUIDString runs the processor over a UUID in its textual form,
+// writing the result in the given format.
+func processUUIDString(processor Processor, preUUID string, format UUIDFormat) (string, error) {
+	var preProc [uuidSize]byte
+	if err := parseUUID(preProc[:], preUUID); err != nil {
 		return "", err
 	}
-	return u.String(), nil
+	return formatProcessedUUID(processor.Process(preProc[:]), preUUID, format)
+}
+
+// formatProcessedUUID returns the processed bytes of preUUID as a UUID
+// in the given format.
+func formatProcessedUUID(postProc []byte, preUUID string, format UUIDFormat) (string, error) {
+	if len(postProc) != uuidSize {
+		return "", fmt.Errorf("%w: invalid UUID (got %d bytes)", ErrBadProcessorOutput, len(postProc))
+	}
+	var buf [maxUUIDLength]byte
+	return string(format.appendFormat(buf[:0], postProc, preUUID)), nil
+}
+
+// fileName returns the name of f, which may be a File or a reader
+// returned by OpenFile, if it has one other than stdin or stdout.
+func fileName(f interface{}) string {
+	if n, ok := f.(interface{ Name() string }); ok && n.Name() != StdPipe {
+		return n.Name()
+	}
+	return ""
 }
 
 func errIfNotEOF(err error) error {
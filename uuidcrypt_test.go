@@ -0,0 +1,188 @@
+package uuidcrypt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+const (
+	testSecret    = "foo"
+	testNamespace = "bar"
+
+	testUUID  = "4a1981ca-94af-481d-8266-58d86cc8199a"
+	testUUID2 = "37abbed5-e81e-45d6-a6d4-3548685203cc"
+)
+
+func failIfError(t *testing.T, err error) {
+	if err != nil {
+		t.Fatalf("encountered error: %v\n", err)
+	}
+}
+
+func assert(t *testing.T, condition bool, description string) {
+	if !condition {
+		t.Fatal(description)
+	}
+}
+
+// memFile is an in-memory File for testing UUIDCrypt.
+type memFile struct {
+	rows [][]string
+}
+
+func (f *memFile) Read() ([]string, error) {
+	if len(f.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := f.rows[0]
+	f.rows = f.rows[1:]
+	return append([]string(nil), row...), nil
+}
+
+func (f *memFile) Write(row []string) error {
+	f.rows = append(f.rows, row)
+	return nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+func runUUIDCrypt(t *testing.T, rows [][]string, processor Processor, options ...UUIDCryptOptions) [][]string {
+	output := &memFile{}
+	err := NewUUIDCrypt(&memFile{rows: rows}, output, processor, options...).Run()
+	failIfError(t, err)
+	return output.rows
+}
+
+func newTestProcessor(namespace string, cryptType CryptType) Processor {
+	return NewCrypterProcessor([]byte(testSecret), []byte(namespace), cryptType)
+}
+
+func TestColumnProcessor(t *testing.T) {
+	input := [][]string{{testUUID, testUUID}, {testUUID2, testUUID2}}
+	output := runUUIDCrypt(t, input, newTestProcessor(testNamespace, EncryptType),
+		WithColumns(1, 2),
+		WithColumnProcessor(2, newTestProcessor("other", EncryptType)),
+	)
+	for i, row := range output {
+		assert(t, row[0] != input[i][0], "column 1 should be encrypted")
+		assert(t, row[1] != input[i][1], "column 2 should be encrypted")
+		assert(t, row[0] != row[1], fmt.Sprintf("columns should use different namespaces: %v", row))
+	}
+	decrypted := runUUIDCrypt(t, output, newTestProcessor(testNamespace, DecryptType),
+		WithColumns(1, 2),
+		WithColumnProcessor(2, newTestProcessor("other", DecryptType)),
+	)
+	for i, row := range decrypted {
+		assert(t, row[0] == input[i][0] && row[1] == input[i][1], "decrypted row should match input")
+	}
+}
+
+func TestContextColumn(t *testing.T) {
+	input := [][]string{{testUUID, "tenant-a"}, {testUUID, "tenant-b"}, {testUUID, "tenant-a"}}
+	output := runUUIDCrypt(t, input, newTestProcessor(testNamespace, EncryptType), WithContextColumn(2))
+	assert(t, output[0][0] != output[1][0], "same uuid should encrypt differently per context")
+	assert(t, output[0][0] == output[2][0], "same uuid should encrypt identically in the same context")
+	assert(t, output[0][1] == "tenant-a", "context column should not be processed")
+
+	decrypted := runUUIDCrypt(t, output, newTestProcessor(testNamespace, DecryptType), WithContextColumn(2))
+	for i, row := range decrypted {
+		assert(t, row[0] == input[i][0], "decrypted row should match input")
+	}
+	noContext := runUUIDCrypt(t, output[:1], newTestProcessor(testNamespace, DecryptType))
+	assert(t, noContext[0][0] != testUUID, "decrypting without the context should not match input")
+
+	err := NewUUIDCrypt(&memFile{rows: input}, &memFile{}, newTestProcessor(testNamespace, EncryptType),
+		WithColumns(1, 2), WithContextColumn(2)).Run()
+	assert(t, errors.Is(err, ErrContextColumnProcessed), fmt.Sprintf("should encounter error: %v", ErrContextColumnProcessed))
+}
+
+func TestHeader(t *testing.T) {
+	input := [][]string{{"id", "org_id"}, {testUUID, testUUID2}}
+	output := runUUIDCrypt(t, input, newTestProcessor(testNamespace, EncryptType), WithHeader(), WithColumnNames("org_id"))
+	assert(t, output[0][0] == "id" && output[0][1] == "org_id", "header should be passed through")
+	assert(t, output[1][0] == testUUID, "unselected column should not be processed")
+	assert(t, output[1][1] != testUUID2, "named column should be processed")
+
+	err := NewUUIDCrypt(&memFile{rows: input}, &memFile{}, newTestProcessor(testNamespace, EncryptType),
+		WithHeader(), WithColumnNames("user_id")).Run()
+	assert(t, errors.Is(err, ErrUnknownColumn), fmt.Sprintf("should encounter error: %v", ErrUnknownColumn))
+
+	err = NewUUIDCrypt(&memFile{rows: input}, &memFile{}, newTestProcessor(testNamespace, EncryptType),
+		WithColumnNames("org_id")).Run()
+	assert(t, errors.Is(err, ErrHeaderRequired), fmt.Sprintf("should encounter error: %v", ErrHeaderRequired))
+
+	err = NewUUIDCrypt(&memFile{rows: append(input, []string{"NULL", testUUID})}, &memFile{},
+		newTestProcessor(testNamespace, EncryptType), WithHeader()).Run()
+	assert(t, err != nil, "bad row after the header should be an error")
+}
+
+func TestRowErrorPolicies(t *testing.T) {
+	input := [][]string{{"id", "data"}, {testUUID, "a"}, {"NULL", "b"}, {"", "c"}, {testUUID2, "d"}}
+	processor := newTestProcessor(testNamespace, EncryptType)
+
+	err := NewUUIDCrypt(&memFile{rows: input}, &memFile{}, processor).Run()
+	assert(t, err != nil, "strict policy should encounter error")
+
+	output := runUUIDCrypt(t, input, processor, WithRowErrorPolicy(RowErrorPassthrough))
+	assert(t, len(output) == 5, fmt.Sprintf("passthrough should keep all rows: %v", output))
+	assert(t, output[0][0] == "id", "header should be passed through")
+	assert(t, output[1][0] != testUUID, "good uuid should be processed")
+	assert(t, output[2][0] == "NULL" && output[3][0] == "", "bad values should be left untouched")
+
+	output = runUUIDCrypt(t, input, processor, WithRowErrorPolicy(RowErrorBlank))
+	assert(t, len(output) == 5, fmt.Sprintf("blank should keep all rows: %v", output))
+	assert(t, output[2][0] == "" && output[2][1] == "b", "bad values should be blanked")
+
+	output = runUUIDCrypt(t, input, processor, WithRowErrorPolicy(RowErrorSkipRow))
+	assert(t, len(output) == 3, fmt.Sprintf("skip-row should drop bad rows: %v", output))
+	assert(t, output[2][1] == "d", "good rows should be kept")
+
+	reject := &memFile{}
+	output = runUUIDCrypt(t, input, processor, WithRowErrorPolicy(RowErrorRejectFile), WithRejectFile(reject))
+	assert(t, len(output) == 3, fmt.Sprintf("reject-file should drop bad rows: %v", output))
+	assert(t, len(reject.rows) == 2, fmt.Sprintf("reject-file should write bad rows: %v", reject.rows))
+	assert(t, reject.rows[0][0] == "3" && reject.rows[0][1] == "NULL", fmt.Sprintf("rejected row should have its line number: %v", reject.rows[0]))
+	assert(t, reject.rows[1][0] == "4" && reject.rows[1][2] == "c", fmt.Sprintf("rejected row should have its line number: %v", reject.rows[1]))
+
+	err = NewUUIDCrypt(&memFile{rows: input}, &memFile{}, processor, WithRowErrorPolicy(RowErrorRejectFile)).Run()
+	assert(t, errors.Is(err, ErrRejectFileRequired), fmt.Sprintf("should encounter error: %v", ErrRejectFileRequired))
+}
+
+func TestBadProcessorOutput(t *testing.T) {
+	input := [][]string{{testUUID}, {testUUID2}, {testUUID}}
+	short := processorFunc(func(in []byte) []byte { return in[:8] })
+
+	err := NewUUIDCrypt(&memFile{rows: input}, &memFile{}, short).Run()
+	var e *Error
+	assert(t, errors.As(err, &e) && e.Kind == CryptoError, fmt.Sprintf("short output should be a crypto error: %v", err))
+
+	output := runUUIDCrypt(t, input, short, WithRowErrorPolicy(RowErrorPassthrough))
+	for i, row := range output {
+		assert(t, row[0] == input[i][0], fmt.Sprintf("row %d should be passed through: %v", i+1, row))
+	}
+}
+
+func TestRowErrorLocation(t *testing.T) {
+	input := &memFile{rows: [][]string{{"id", "user_id"}, {"1", testUUID}, {"2", "NULL"}}}
+	err := NewUUIDCrypt(input, &memFile{}, newTestProcessor(testNamespace, EncryptType), WithColumns(2)).Run()
+	var e *Error
+	assert(t, errors.As(err, &e), fmt.Sprintf("should encounter *Error: %v", err))
+	assert(t, e.Kind == ParseError, fmt.Sprintf("error should be a parse error: %v", e.Kind))
+	assert(t, e.Line == 3 && e.Column == 2, fmt.Sprintf("error should be at line 3, column 2: %v", e))
+}
+
+func BenchmarkRun(b *testing.B) {
+	rows := testRows(4 * batchSize)
+	processor := NewCrypterProcessor([]byte(testSecret), []byte(testNamespace), EncryptType)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		input := &memFile{rows: rows}
+		if err := NewUUIDCrypt(input, &memFile{}, processor, WithRowErrorPolicy(RowErrorPassthrough)).Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
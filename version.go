@@ -1,4 +1,4 @@
-package main
+package uuidcrypt
 
 // Version is the current uuidcrypt version.
 var Version = "0.1.5"